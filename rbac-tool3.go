@@ -1,16 +1,28 @@
 package main
 import (
+    "archive/tar"
+    "compress/gzip"
+    "context"
     "encoding/json"
     "encoding/csv"
+    "encoding/base64"
+    "crypto/tls"
+    "crypto/x509"
     "fmt"
+    "io"
+    "net/http"
+    "net/url"
     "os"
     "os/exec"
+    "os/signal"
+    "path/filepath"
+    "strconv"
     "strings"
     "text/tabwriter"
+    "time"
     "flag"
     "sort"
-    "bufio"
-    "bytes"
+    "sync"
     "log"
 )
 
@@ -25,17 +37,40 @@ type InputFlags struct {
     ExtendedOption    bool // --extended or -ext
     MoreOption        bool // --more
     Service           bool // --service
+    Groups            bool // --groups: also list Group subjects (system:authenticated, OIDC groups, ...)
+    Implicit          bool // --implicit: also give Users the bindings of system:authenticated
+    Overpowered       bool // --overpowered or -op: list the dangerous permissions of each account
+    GroupMembers      string // --group-members: YAML/JSON, CSV or LDIF file mapping groups to users
+    CheckArgs         []string // 'check <subject> <verb> <resource>', 'who-can <verb> <resource>' or 'escalation-paths <subject>'
+    ObjectName        string // --name: object name for 'check' and 'who-can'
+    PolicyPath        string // policy file of 'lint'
+    Target            string // --target: privilege level for 'escalation-paths' (cluster-admin or namespace-admin:<ns>)
     KubeSphere        bool // Is it KubeSphere specific? (or not KubeSphere)
     OnlyOption        []string // --only with parameters: decide what kind of role you want to print.
+    Kubeconfig        string // --kubeconfig: path to the kubeconfig file
+    Context           string // --context: kubeconfig context (cluster) to use
+    Namespace         string // --namespace or -n: limit namespaced kinds to one namespace
+    From              string // --from: read RBAC objects from a file, a directory or stdin ("-") instead of a cluster
+    Snapshot          string // --snapshot: read RBAC objects from a snapshot archive
+    SnapshotPath      string // archive path of 'snapshot save' and 'snapshot info'
+    DiffPaths         []string // snapshots to compare with 'diff'
+    ChunkSize         int // --chunk-size: items per list request (default 500, 0 disables paging)
+    Contexts          []string // --contexts a,b,c: run against several kubeconfig contexts
+    AllContexts       bool // --all-contexts: run against every context of the kubeconfig
+    Expand            bool // --expand: expand wildcard apiGroups and resources using API discovery
+    Discovery         string // --discovery: API discovery dump to use offline
 }
 
 
 // structures for Roles (Typically, roles are associated with a NAMESPACE.)
 type Role struct {
+    Cluster    string       `json:"-"` // kubeconfig context it was read from, in multi-cluster mode
     APIVersion string       `json:"apiVersion"`
     Kind       string       `json:"kind"`
     Metadata   RoleMetadata `json:"metadata"`
     Rules      []RoleRule   `json:"rules"`
+    AggregationRule *AggregationRule `json:"aggregationRule,omitempty"` // ClusterRoles only
+    AggregatedFrom  []string `json:"-"` // ClusterRoles selected by AggregationRule
 }
 type RoleMetadata struct {
     Annotations        map[string]string `json:"annotations"`
@@ -47,14 +82,30 @@ type RoleMetadata struct {
     UID                string            `json:"uid"`
 }
 type RoleRule struct {
-    APIGroups     []string `json:"apiGroups"`
-    ResourceNames []string `json:"resourceNames,omitempty"`
-    Resources     []string `json:"resources"`
-    Verbs         []string `json:"verbs"`
+    APIGroups       []string `json:"apiGroups"`
+    ResourceNames   []string `json:"resourceNames,omitempty"`
+    Resources       []string `json:"resources"`
+    NonResourceURLs []string `json:"nonResourceURLs,omitempty"` // e.g. /metrics, /healthz; ClusterRoles only
+    Verbs           []string `json:"verbs"`
+}
+
+// An aggregated ClusterRole (admin, edit, view, ...) gets the rules of every ClusterRole matching one of its selectors.
+type AggregationRule struct {
+    ClusterRoleSelectors []LabelSelector `json:"clusterRoleSelectors"`
+}
+type LabelSelector struct {
+    MatchLabels      map[string]string          `json:"matchLabels,omitempty"`
+    MatchExpressions []LabelSelectorRequirement `json:"matchExpressions,omitempty"`
+}
+type LabelSelectorRequirement struct {
+    Key      string   `json:"key"`
+    Operator string   `json:"operator"` // In, NotIn, Exists or DoesNotExist
+    Values   []string `json:"values,omitempty"`
 }
 
 // Structures for Role Bindings
 type RoleBinding struct {
+    Cluster    string   `json:"-"` // kubeconfig context it was read from, in multi-cluster mode
     ApiVersion string   `json:"apiVersion"`
     Kind       string   `json:"kind"`
     Metadata   RoleBindingMeta `json:"metadata"`
@@ -104,26 +155,54 @@ type BindingInfo struct {
     RoleRefKind string `json:"roleRefKind"`
     // 구조체의 재사용
     ExtraRules []RoleRule `json:"rules"`
+    ViaGroup   string `json:"viaGroup,omitempty"` // the Group subject a member inherited this binding from
+    Implicit   bool `json:"implicit,omitempty"` // ViaGroup is a group Kubernetes puts the account in by itself
+    Unresolved bool `json:"unresolved,omitempty"` // the roleRef points to a role that doesn't exist (set with --more)
+    Default    bool `json:"default,omitempty"` // part of the default policy of Kubernetes (labeled rbac-defaults)
 }
 
 type AccountInfo struct {
+    Cluster       string        `json:"cluster,omitempty"` // kubeconfig context, in multi-cluster mode
     Name     	  string        `json:"name"`
     Type          string        `json:"kind"`
+    Namespace     string        `json:"namespace,omitempty"` // ServiceAccounts only; with Type and Name it identifies the account
     Bindings	  []BindingInfo `json:"bindings"`
 }
 
 var USERLIST []AccountInfo
 
+// group name -> users, loaded from --group-members
+var GROUPMEMBERS map[string][]string
+
+// the bindings of every Group subject, collected while USERLIST is built, for the implicit group memberships
+var GROUPBINDINGS map[string][]BindingInfo
+
 
 
 func parseInputFlags() InputFlags {
     var flags InputFlags
 
+    // global options may also be given before the command
+    flag.StringVar(&flags.Kubeconfig, "kubeconfig", "", "path to the kubeconfig file")
+    flag.StringVar(&flags.Context, "context", "", "kubeconfig context to use")
+    flag.StringVar(&flags.Namespace, "namespace", "", "limit roles and rolebindings to this namespace")
+    flag.StringVar(&flags.Namespace, "n", "", "shorthand for --namespace")
+    flag.StringVar(&flags.From, "from", "", "read RBAC objects from a file, directory or stdin (-)")
+    flag.StringVar(&flags.Snapshot, "snapshot", "", "read RBAC objects from a snapshot archive")
+    flag.IntVar(&flags.ChunkSize, "chunk-size", 500, "items per list request (0 disables paging)")
+    flag.BoolVar(&flags.AllContexts, "all-contexts", false, "run against every context of the kubeconfig")
+    flag.BoolVar(&flags.Expand, "expand", false, "expand wildcard apiGroups and resources using API discovery")
+    flag.StringVar(&flags.Discovery, "discovery", "", "API discovery dump (JSON) to use offline")
+    flag.StringVar(&flags.GroupMembers, "group-members", "", "group membership file (YAML/JSON, CSV or LDIF)")
+    flag.Func("contexts", "run against these kubeconfig contexts (comma separated)", func(value string) error {
+        flags.Contexts = splitList(value)
+        return nil
+    })
     flag.Parse()
     args := flag.Args()
 
     if len(args) == 0 {
-        fmt.Println("No arguments provided.\n")
+        fmt.Print("No arguments provided.\n\n")
         displayUsage()
         os.Exit(1)
     }
@@ -168,6 +247,75 @@ func parseInputFlags() InputFlags {
             fmt.Println("Expected a resource type argument after 'show'.")
             os.Exit(1)
         }
+    case "snapshot":
+        flags.CommandType = "snapshot"
+        if len(args) > 2 && (args[1] == "save" || args[1] == "info") {
+            flags.ResourceType = args[1]
+            flags.SnapshotPath = args[2]
+        } else {
+            fmt.Println("Expected 'snapshot save <path>' or 'snapshot info <path>'.")
+            os.Exit(1)
+        }
+    case "diff":
+        flags.CommandType = "diff"
+        for _, arg := range args[1:] {
+            if strings.HasPrefix(arg, "-") {
+                break
+            }
+            flags.DiffPaths = append(flags.DiffPaths, arg)
+        }
+        if len(flags.DiffPaths) < 1 || len(flags.DiffPaths) > 2 {
+            fmt.Println("Expected 'diff <old snapshot> [<new snapshot>]'.")
+            os.Exit(1)
+        }
+    case "check":
+        flags.CommandType = "check"
+        for _, arg := range args[1:] {
+            if strings.HasPrefix(arg, "-") {
+                break
+            }
+            flags.CheckArgs = append(flags.CheckArgs, arg)
+        }
+        if len(flags.CheckArgs) != 3 {
+            fmt.Println("Expected 'check <subject> <verb> <resource>[/<subresource>]'.")
+            os.Exit(1)
+        }
+    case "who-can":
+        flags.CommandType = "who-can"
+        for _, arg := range args[1:] {
+            if strings.HasPrefix(arg, "-") {
+                break
+            }
+            flags.CheckArgs = append(flags.CheckArgs, arg)
+        }
+        if len(flags.CheckArgs) != 2 {
+            fmt.Println("Expected 'who-can <verb> <resource>[/<subresource>]'.")
+            os.Exit(1)
+        }
+    case "escalation-paths":
+        flags.CommandType = "escalation-paths"
+        if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+            flags.CheckArgs = []string{args[1]}
+        } else {
+            fmt.Println("Expected 'escalation-paths <subject>'.")
+            os.Exit(1)
+        }
+    case "benchmark":
+        flags.CommandType = "benchmark"
+        if len(args) > 1 && args[1] == "cis" {
+            flags.ResourceType = "cis"
+        } else {
+            fmt.Println("Expected 'benchmark cis'.")
+            os.Exit(1)
+        }
+    case "lint":
+        flags.CommandType = "lint"
+        if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+            flags.PolicyPath = args[1]
+        } else {
+            fmt.Println("Expected 'lint <policy file>'.")
+            os.Exit(1)
+        }
     case "get":
         flags.CommandType = "get"
         if len(args) > 1 {
@@ -181,7 +329,16 @@ func parseInputFlags() InputFlags {
         os.Exit(1)
     }
 
-    for i, arg := range args {
+    for i := 0; i < len(args); i++ {
+        arg := args[i]
+        // "--option=value" is accepted as well as "--option value"
+        value, hasValue := "", false
+        if strings.HasPrefix(arg, "-") {
+            if eq := strings.Index(arg, "="); eq > 0 {
+                arg, value, hasValue = arg[:eq], arg[eq+1:], true
+            }
+        }
+
         switch arg {
         case "--nosys":
             flags.ExcludeSystem = true
@@ -191,6 +348,12 @@ func parseInputFlags() InputFlags {
             flags.MoreOption = true
         case "--service":
             flags.Service = true
+        case "--groups":
+            flags.Groups = true
+        case "--implicit":
+            flags.Implicit = true
+        case "--overpowered", "-op":
+            flags.Overpowered = true
 	case "--kubesphere", "-ks":
 	    flags.KubeSphere = true
         case "--only":
@@ -212,6 +375,48 @@ func parseInputFlags() InputFlags {
                 fmt.Println("Expected a value after '--only' option.")
                 os.Exit(1)
             }
+        case "--all-contexts":
+            flags.AllContexts = true
+        case "--expand":
+            flags.Expand = true
+        case "--kubeconfig", "--context", "--namespace", "-n", "--from", "--snapshot", "--chunk-size", "--contexts", "--discovery", "--group-members", "--name", "--target":
+            if !hasValue {
+                if i+1 >= len(args) {
+                    fmt.Printf("Expected a value after '%s' option.\n", arg)
+                    os.Exit(1)
+                }
+                value = args[i+1]
+                i++
+            }
+            switch arg {
+            case "--kubeconfig":
+                flags.Kubeconfig = value
+            case "--context":
+                flags.Context = value
+            case "--from":
+                flags.From = value
+            case "--snapshot":
+                flags.Snapshot = value
+            case "--contexts":
+                flags.Contexts = splitList(value)
+            case "--discovery":
+                flags.Discovery = value
+            case "--group-members":
+                flags.GroupMembers = value
+            case "--name":
+                flags.ObjectName = value
+            case "--target":
+                flags.Target = value
+            case "--chunk-size":
+                size, err := strconv.Atoi(value)
+                if err != nil || size < 0 {
+                    fmt.Printf("Invalid value provided after '--chunk-size' option: '%s'.\n", value)
+                    os.Exit(1)
+                }
+                flags.ChunkSize = size
+            default:
+                flags.Namespace = value
+            }
         case "csv":
             if i+1 < len(args) {
                 flags.CSVType = args[i+1]
@@ -225,6 +430,17 @@ func parseInputFlags() InputFlags {
     return flags
 }
 
+// splits a comma separated option value, dropping empty entries
+func splitList(value string) []string {
+    var items []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
 func displayUsage() {
     fmt.Println("+-----------------------------------------------------------------------------------+")
     fmt.Println("|                                    RBAC Tool Usage                                |")
@@ -247,13 +463,13 @@ func displayUsage() {
     fmt.Println("|-----------------------------------------------------------------------------------|")
     fmt.Println("| Get a list of user priviliges in Kubernetes, reordered around user accounts.      |")
     fmt.Println("|-----------------------------------------------------------------------------------|")
-    fmt.Println("| get user [--more] [--service] [--only (with parameters)]                          |")
+    fmt.Println("| get user [--more] [--service] [--groups] [--implicit] [--only (with parameters)]  |")
     fmt.Println("|                                                                                   |")
     fmt.Println("| --only option can take multiple values, separated by commas.                      |")
     fmt.Println("| the parameters: rolebinding, clusterrolebinding, workspacebinding, globalbinding  |")
     fmt.Println("|                                                                                   |")
     fmt.Println("| Example:                                                                          |")
-    fmt.Println("| get user --more --service --only rolebinding, clusterrolebinding                  |")
+    fmt.Println("| get user --more --service --groups --only rolebinding, clusterrolebinding         |")
     fmt.Println("|                                                                                   |")
     fmt.Println("|-----------------------------------------------------------------------------------|")
     fmt.Println("| Save a list of user priviliges in Kubernetes as a CSV file.                       |")
@@ -262,6 +478,60 @@ func displayUsage() {
     fmt.Println("|                                                                                   |")
     fmt.Println("| Example:                                                                          |")
     fmt.Println("| get csv user --more --service --only rolebinding, clusterrolebinding              |")
+    fmt.Println("|                                                                                   |")
+    fmt.Println("| get user --overpowered | -op  (also with 'get csv user', saved as overpowered.csv)|")
+    fmt.Println("|   risky permissions of each account (cluster-admin, secrets, exec, bind, ...)     |")
+    fmt.Println("|                                                                                   |")
+    fmt.Println("|-----------------------------------------------------------------------------------|")
+    fmt.Println("| List dangling roleRefs, unreferenced roles and missing ServiceAccount subjects    |")
+    fmt.Println("|-----------------------------------------------------------------------------------|")
+    fmt.Println("| get orphans [--nosys]                                                             |")
+    fmt.Println("| get csv orphans [--nosys]                                                         |")
+    fmt.Println("|                                                                                   |")
+    fmt.Println("|-----------------------------------------------------------------------------------|")
+    fmt.Println("| Check whether a subject may do something, and which binding allows it             |")
+    fmt.Println("|-----------------------------------------------------------------------------------|")
+    fmt.Println("| check <subject> <verb> <resource>[.<group>][/<subresource>] [-n <ns>] [--name <n>]|")
+    fmt.Println("|   subject: alice, User:alice, Group:devs, ServiceAccount:<ns>/<name>              |")
+    fmt.Println("|   or system:serviceaccount:<ns>:<name>; a non-resource URL such as /metrics may   |")
+    fmt.Println("|   replace the resource                                                            |")
+    fmt.Println("|                                                                                   |")
+    fmt.Println("| who-can <verb> <resource>[.<group>][/<subresource>] [-n <ns>] [--name <n>]        |")
+    fmt.Println("|   every User, Group and ServiceAccount allowed to do it, with binding and role    |")
+    fmt.Println("|                                                                                   |")
+    fmt.Println("| escalation-paths <subject> [--target cluster-admin | namespace-admin:<ns>]        |")
+    fmt.Println("|   chains of permissions (create pods, bind, impersonate...) leading to the target |")
+    fmt.Println("|                                                                                   |")
+    fmt.Println("| lint <policy.yaml>                                                                |")
+    fmt.Println("|   checks the accounts against the rules of a policy file; exits with 1 on errors  |")
+    fmt.Println("|                                                                                   |")
+    fmt.Println("| benchmark cis [--nosys]                                                           |")
+    fmt.Println("|   CIS Kubernetes Benchmark 5.1 (RBAC) controls: pass/fail/manual with evidence    |")
+    fmt.Println("|                                                                                   |")
+    fmt.Println("|-----------------------------------------------------------------------------------|")
+    fmt.Println("| Save the full RBAC state of a cluster, to audit it later with --snapshot          |")
+    fmt.Println("|-----------------------------------------------------------------------------------|")
+    fmt.Println("| snapshot save <path.tar.gz> [--namespace <ns>]                                    |")
+    fmt.Println("| snapshot info <path.tar.gz>                                                       |")
+    fmt.Println("|                                                                                   |")
+    fmt.Println("| diff <old.tar.gz> [<new.tar.gz>]                                                  |")
+    fmt.Println("|   without a second snapshot, compares with the live cluster (or --from/--snapshot)|")
+    fmt.Println("|                                                                                   |")
+    fmt.Println("|-----------------------------------------------------------------------------------|")
+    fmt.Println("| Global options (for every command)                                                |")
+    fmt.Println("|-----------------------------------------------------------------------------------|")
+    fmt.Println("| --kubeconfig <path>        kubeconfig file (default: $KUBECONFIG, ~/.kube/config) |")
+    fmt.Println("| --context <name>           kubeconfig context to use (default: current-context)   |")
+    fmt.Println("| --namespace | -n <ns>      only read Roles and RoleBindings of this namespace     |")
+    fmt.Println("| --from <file | dir | ->    read RBAC objects from YAML/JSON files instead of a    |")
+    fmt.Println("|                            cluster (e.g. 'kubectl get ... -o yaml' dumps)         |")
+    fmt.Println("| --snapshot <path>          read RBAC objects from a snapshot archive              |")
+    fmt.Println("| --chunk-size <n>           items per list request (default 500, 0 = no paging)    |")
+    fmt.Println("| --contexts <a,b,c>         run 'show' tables and 'get user' against several       |")
+    fmt.Println("| --all-contexts             contexts at once; output gets a leading Cluster column |")
+    fmt.Println("| --expand                   list the resources that wildcard rules really cover    |")
+    fmt.Println("| --discovery <file>         API discovery dump for --expand and 'show core' offline|")
+    fmt.Println("| --group-members <file>     expand Group subjects into users (YAML, CSV or LDIF)   |")
     fmt.Println("+-----------------------------------------------------------------------------------+")
 }
 
@@ -272,6 +542,13 @@ type SortByAPIGroup []RoleRule
 func (a SortByAPIGroup) Len() int           { return len(a) }
 func (a SortByAPIGroup) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a SortByAPIGroup) Less(i, j int) bool {
+    // non-resource rules come after all resource rules
+    if iURL, jURL := len(a[i].NonResourceURLs) > 0, len(a[j].NonResourceURLs) > 0; iURL || jURL {
+        if iURL && jURL {
+            return a[i].NonResourceURLs[0] < a[j].NonResourceURLs[0]
+        }
+        return jURL
+    }
     if len(a[i].APIGroups) == 0 {
         return true
     }
@@ -284,25 +561,28 @@ func (a SortByAPIGroup) Less(i, j int) bool {
 // merge Verbs from rules.
 func mergeRules(rules []RoleRule) []RoleRule {
     merged := make(map[string]map[string]map[string]struct{})
-    allVerbs := map[string]struct{}{
-        "get":              {},
-        "list":             {},
-        "watch":            {},
-        "create":           {},
-        "delete":           {},
-        "deletecollection": {},
-        "patch":            {},
-        "update":           {},
-    }
 
+// verbs per non-resource URL
+mergedURLs := make(map[string]map[string]struct{})
 
 for _, rule := range rules {
+    for _, url := range rule.NonResourceURLs {
+        if _, ok := mergedURLs[url]; !ok {
+            mergedURLs[url] = make(map[string]struct{})
+        }
+        for _, verb := range rule.Verbs {
+            mergedURLs[url][verb] = struct{}{}
+        }
+    }
+    // a rule limited to resourceNames is kept apart from unrestricted access to the same resource
+    names := append([]string(nil), rule.ResourceNames...)
+    sort.Strings(names)
     for _, apiGroup := range rule.APIGroups {
         for _, resource := range rule.Resources {
 
-            // 만약 resourceNames이 존재한다면 resource를 변경
-            if len(rule.ResourceNames) > 0 {
-                resource = fmt.Sprintf("%s.%s", resource, rule.ResourceNames[0]) // 여기서는 ResourceNames 중 첫 번째 것만을 사용
+            // 만약 resourceNames이 존재한다면 resource key에 모든 이름을 붙인다
+            if len(names) > 0 {
+                resource = resource + "\x00" + strings.Join(names, "\x00")
             }
 
             if _, ok := merged[apiGroup]; !ok {
@@ -335,26 +615,110 @@ for _, rule := range rules {
         }
         sort.Strings(sortedResources)
         for _, resource := range sortedResources {
-            verbs := resourceVerbMap[resource]
-            var verbList []string
-            if len(verbs) == len(allVerbs) {
-                verbList = []string{"*"}
-            } else {
-                for verb := range verbs {
-                    verbList = append(verbList, verb)
-                }
-                sort.Strings(verbList)
-            }
+            verbList := sortedVerbs(resourceVerbMap[resource])
+            parts := strings.Split(resource, "\x00")
             mergedRules = append(mergedRules, RoleRule{
-                APIGroups: []string{apiGroup},
-                Resources: []string{resource},
-                Verbs:     verbList,
+                APIGroups:     []string{apiGroup},
+                Resources:     []string{parts[0]},
+                ResourceNames: parts[1:],
+                Verbs:         verbList,
             })
         }
     }
+
+    var sortedURLs []string
+    for url := range mergedURLs {
+        sortedURLs = append(sortedURLs, url)
+    }
+    sort.Strings(sortedURLs)
+    for _, url := range sortedURLs {
+        mergedRules = append(mergedRules, RoleRule{
+            NonResourceURLs: []string{url},
+            Verbs:           sortedVerbs(mergedURLs[url]),
+        })
+    }
     return mergedRules
 }
 
+// Verbs in display order: the usual read and write verbs, then the special verbs. Those grant more than access to
+// objects: bind and escalate let a subject grant or create roles beyond its own rights, impersonate lets it act as
+// someone else, use allows PodSecurityPolicies and similar, approve and sign act on CertificateSigningRequests.
+var verbOrder = []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection", "bind", "escalate", "impersonate", "use", "approve", "sign"}
+var specialVerbs = map[string]bool{"bind": true, "escalate": true, "impersonate": true, "use": true, "approve": true, "sign": true}
+
+// Sorts a merged verb set. A real "*" grant covers every verb, including ones added later, so it replaces the set;
+// an explicit list is kept as it is, however complete it looks.
+func sortedVerbs(verbs map[string]struct{}) []string {
+    if _, ok := verbs["*"]; ok {
+        return []string{"*"}
+    }
+    rank := make(map[string]int)
+    for i, verb := range verbOrder {
+        rank[verb] = i + 1
+    }
+    var verbList []string
+    for verb := range verbs {
+        verbList = append(verbList, verb)
+    }
+    sort.Slice(verbList, func(i, j int) bool {
+        ri, rj := rank[verbList[i]], rank[verbList[j]]
+        switch {
+        case ri != 0 && rj != 0:
+            return ri < rj
+        case ri != 0 || rj != 0:
+            return ri != 0 // known verbs before unknown ones
+        }
+        return verbList[i] < verbList[j]
+    })
+    return verbList
+}
+
+// The Verbs cell of a rule. "*" is spelled out so it can't be confused with an explicit list, and special verbs are
+// marked with "(!)".
+func verbsCell(verbs []string) string {
+    var cells []string
+    for _, verb := range verbs {
+        switch {
+        case verb == "*":
+            cells = append(cells, "* (all verbs)")
+        case specialVerbs[verb]:
+            cells = append(cells, verb+"(!)")
+        default:
+            cells = append(cells, verb)
+        }
+    }
+    return strings.Join(cells, ", ")
+}
+
+// The (apiGroups, Resources) cells a rule is displayed with. Wildcard apiGroups and resources are spelled out. A rule limited to resourceNames shows them after the
+// resource, so it can't be mistaken for access to every object of that resource. Non-resource rules show their
+// URLs in the Resources column; wildcard URLs such as "/*" are flagged because they open every endpoint below them.
+func ruleCells(rule RoleRule) [][2]string {
+    var cells [][2]string
+    for _, apiGroup := range rule.APIGroups {
+        if apiGroup == "*" {
+            apiGroup = "* (all API groups)"
+        }
+        for _, resource := range rule.Resources {
+            // "*" covers every resource, "*/scale" the scale subresource of every resource
+            if resource == "*" || strings.HasPrefix(resource, "*/") {
+                resource += " (all resources)"
+            }
+            if len(rule.ResourceNames) > 0 {
+                resource = fmt.Sprintf("%s (only: %s)", resource, strings.Join(rule.ResourceNames, ", "))
+            }
+            cells = append(cells, [2]string{apiGroup, resource})
+        }
+    }
+    for _, url := range rule.NonResourceURLs {
+        if strings.HasSuffix(url, "*") {
+            url += " (!wildcard)"
+        }
+        cells = append(cells, [2]string{"(non-resource)", url})
+    }
+    return cells
+}
+
 // Check if the role name has a default system prefix
 func isSystemPrefix(itemName string, prefixes []string) bool {
     for _, prefix := range prefixes {
@@ -366,722 +730,5298 @@ func isSystemPrefix(itemName string, prefixes []string) bool {
 }
 
 
-func displayBuiltInVerbs() {
-    cmd := exec.Command("sh", "-c", "kubectl api-resources --no-headers --sort-by name -o wide | sed 's/.*\\[//g' | tr -d \"]\" | tr \" \" \"\\n\" | sort | uniq")
-    output, err := cmd.Output()
-    if err != nil {
-        fmt.Println("Error executing the command:", err)
-        return
+func displayBuiltInVerbs(lists []APIResourceList) {
+    verbSet := make(map[string]struct{})
+    for _, list := range lists {
+        for _, resource := range list.Resources {
+            if strings.Contains(resource.Name, "/") { // subresources are not listed by 'kubectl api-resources'
+                continue
+            }
+            for _, verb := range resource.Verbs {
+                verbSet[verb] = struct{}{}
+            }
+        }
     }
+    var verbs []string
+    for verb := range verbSet {
+        verbs = append(verbs, verb)
+    }
+    sort.Strings(verbs)
+
     fmt.Println("# Built-in Default Available Verbs")
-    fmt.Println(string(output))
+    fmt.Println(strings.Join(verbs, "\n"))
 }
 
-func displayCoreResources() {
-    cmd := exec.Command("kubectl", "api-resources", "--api-group=", "--no-headers")
-    output, err := cmd.Output()
-    if err != nil {
-        fmt.Println("Error executing kubectl api-resources command:", err)
-        return
+func displayCoreResources(lists []APIResourceList) {
+    var names []string
+    for _, list := range lists {
+        if list.GroupVersion != "v1" {
+            continue
+        }
+        for _, resource := range list.Resources {
+            if !strings.Contains(resource.Name, "/") {
+                names = append(names, resource.Name)
+            }
+        }
     }
+    sort.Strings(names)
 
-    readLines := bufio.NewScanner(bytes.NewReader(output))
     fmt.Println("# In Kubernetes, when the \"apiGroups\" entry is empty, it specifically refers to the following resources")
-    fmt.Println("# (Built-in CORE API Resources)\n")
-    for readLines.Scan() {
-        line := readLines.Text()
-        fields := strings.Fields(line) // Split the line by whitespace
-        if len(fields) >= 5 {
-            fmt.Println(fields[4])
-        }
+    fmt.Print("# (Built-in CORE API Resources)\n\n")
+    for _, name := range names {
+        fmt.Println(name)
     }
     fmt.Println()
 }
 
-// Collects all Roles and Cluster Roles. In addition, it also collects Workspace Roles and Global Roles. It's the Kubesphere-specific role type.
-func storeKubernetesRoles(roleType string) ([]Role, error) {
-    var cmd *exec.Cmd
+// ---------------------------------------------------------------------------------------
+// Minimal YAML reader
+// kubeconfig files are YAML. To keep the tool free of external libraries, this reads the
+// subset of YAML that kubectl and the usual kubeconfig writers produce:
+// block mappings and sequences, flow collections, quoted/plain scalars and block scalars.
+// ---------------------------------------------------------------------------------------
+
+type yamlLine struct {
+    num    int    // line number in the document, for error messages
+    indent int    // -1 for blank lines
+    text   string // content without indentation and trailing comment
+    raw    string // original line, used by block scalars
+}
 
-    switch roleType {
-    case "roles":
-        cmd = exec.Command("kubectl", "get", "roles", "-A", "-o", "json")
-    case "workspaceroles":
-        cmd = exec.Command("kubectl", "get", "workspaceroles", "-A", "-o", "json")
-    case "clusterroles":
-        cmd = exec.Command("kubectl", "get", "clusterroles", "-o", "json")
-    case "globalroles":
-        cmd = exec.Command("kubectl", "get", "globalroles", "-o", "json")
-    default:
-        return nil, fmt.Errorf("Invalid role type: %s", roleType)
+type yamlParser struct {
+    lines []yamlLine
+    pos   int
+}
+
+// splits a multi-document stream on '---' separators
+func splitYAMLDocuments(data []byte) []string {
+    var docs []string
+    var current []string
+    for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+        trimmed := strings.TrimRight(line, " \t")
+        if trimmed == "---" || trimmed == "..." || strings.HasPrefix(trimmed, "--- ") {
+            docs = append(docs, strings.Join(current, "\n"))
+            current = nil
+            if strings.HasPrefix(trimmed, "--- ") {
+                current = append(current, strings.TrimPrefix(trimmed, "--- "))
+            }
+            continue
+        }
+        current = append(current, line)
     }
+    return append(docs, strings.Join(current, "\n"))
+}
 
-    output, err := cmd.Output()
-    if err != nil {
-        return nil, err
+// parses every document of a YAML stream. Empty documents are skipped.
+func parseYAMLDocuments(data []byte) ([]interface{}, error) {
+    var values []interface{}
+    for _, doc := range splitYAMLDocuments(data) {
+        value, err := parseYAML(doc)
+        if err != nil {
+            return nil, err
+        }
+        if value != nil {
+            values = append(values, value)
+        }
     }
+    return values, nil
+}
 
-    var rolesList struct {
-        Items []Role `json:"items"`
+// parses a single YAML document into maps, slices and scalars (the same shapes encoding/json uses)
+func parseYAML(doc string) (interface{}, error) {
+    p := &yamlParser{}
+    // the newline ending the last line does not start another (blank) line
+    for i, raw := range strings.Split(strings.TrimSuffix(doc, "\n"), "\n") {
+        text := stripYAMLComment(raw)
+        trimmed := strings.TrimLeft(text, " ")
+        if strings.TrimSpace(trimmed) == "" {
+            p.lines = append(p.lines, yamlLine{num: i + 1, indent: -1, raw: raw})
+            continue
+        }
+        if strings.HasPrefix(trimmed, "%") { // directives such as %YAML 1.2
+            continue
+        }
+        p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t"), raw: raw})
     }
 
-    err = json.Unmarshal(output, &rolesList)
+    p.skipBlank()
+    if p.pos >= len(p.lines) {
+        return nil, nil
+    }
+    value, err := p.parseNode(p.lines[p.pos].indent)
     if err != nil {
         return nil, err
     }
-
-    // apiGroups 정렬 및 Verbs 병합
-    for i := range rolesList.Items {
-        rolesList.Items[i].Rules = mergeRules(rolesList.Items[i].Rules)
-        sort.Sort(SortByAPIGroup(rolesList.Items[i].Rules))
+    p.skipBlank()
+    if p.pos < len(p.lines) {
+        return nil, fmt.Errorf("yaml: line %d: unexpected content %q", p.lines[p.pos].num, p.lines[p.pos].text)
     }
+    return value, nil
+}
 
-    return rolesList.Items, nil
+// removes a trailing '# comment', ignoring '#' inside quoted scalars
+func stripYAMLComment(line string) string {
+    var quote byte
+    for i := 0; i < len(line); i++ {
+        c := line[i]
+        switch {
+        case quote == '"' && c == '\\':
+            i++
+        case quote != 0:
+            if c == '\'' && i+1 < len(line) && line[i+1] == '\'' {
+                i++ // '' is an escaped single quote
+            } else if c == quote {
+                quote = 0
+            }
+        case c == '"' || c == '\'':
+            // a quote only opens a quoted scalar at the start of a value
+            if i == 0 || strings.IndexByte(" \t[{,:-", line[i-1]) >= 0 {
+                quote = c
+            }
+        case c == '#':
+            if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+                return line[:i]
+            }
+        }
+    }
+    return line
 }
 
+func (p *yamlParser) skipBlank() {
+    for p.pos < len(p.lines) && p.lines[p.pos].indent < 0 {
+        p.pos++
+    }
+}
 
-func storeBindings(resourceType string) ([]RoleBinding, error) {
-    var cmd *exec.Cmd
+func isYAMLSeqItem(text string) bool {
+    return text == "-" || strings.HasPrefix(text, "- ")
+}
 
-    switch resourceType {
-    case "clusterrolebindings":
-        cmd = exec.Command("kubectl", "get", "clusterrolebindings", "-o", "json")
-    case "rolebindings":
-        cmd = exec.Command("kubectl", "get", "rolebindings", "-A", "-o", "json")
-    case "workspacerolebindings":
-        cmd = exec.Command("kubectl", "get", "workspacerolebindings", "-A", "-o", "json")
-    case "globalrolebindings":
-        cmd = exec.Command("kubectl", "get", "globalrolebindings", "-o", "json")
-    default:
-        return nil, fmt.Errorf("invalid resource type: %s", resourceType)
+// splits "key: value" into its parts. ok is false when the text is not a mapping entry.
+func splitYAMLKey(text string) (key string, rest string, ok bool) {
+    if text == "" || text[0] == '[' || text[0] == '{' || isYAMLSeqItem(text) {
+        return "", "", false
     }
-
-    output, err := cmd.Output()
-    if err != nil {
-        return nil, err
+    if text[0] == '"' || text[0] == '\'' {
+        end := closingQuote(text)
+        if end < 0 {
+            return "", "", false
+        }
+        after := strings.TrimLeft(text[end+1:], " ")
+        if !strings.HasPrefix(after, ":") || (len(after) > 1 && after[1] != ' ') {
+            return "", "", false
+        }
+        unquoted, err := parseYAMLScalar(text[:end+1])
+        if err != nil {
+            return "", "", false
+        }
+        return fmt.Sprint(unquoted), strings.TrimSpace(after[1:]), true
     }
-
-    var bindingsList struct {
-        Items []RoleBinding `json:"items"`
+    for i := 0; i < len(text); i++ {
+        if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\t') {
+            return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+        }
     }
+    return "", "", false
+}
 
-    err = json.Unmarshal(output, &bindingsList)
-    if err != nil {
-        return nil, err
+// returns the index of the quote that closes the quoted scalar starting at text[0], or -1
+func closingQuote(text string) int {
+    quote := text[0]
+    for i := 1; i < len(text); i++ {
+        switch {
+        case quote == '"' && text[i] == '\\':
+            i++
+        case text[i] == quote:
+            if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+                i++ // '' is an escaped single quote
+                continue
+            }
+            return i
+        }
     }
-
-    return bindingsList.Items, nil
+    return -1
 }
 
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+    line := p.lines[p.pos]
+    if isYAMLSeqItem(line.text) {
+        return p.parseSequence(line.indent)
+    }
+    if _, _, ok := splitYAMLKey(line.text); ok {
+        return p.parseMapping(line.indent)
+    }
+    p.pos++
+    return p.parseValue(indent-1, line.text, false)
+}
 
-// function for drawing a table and displaying typical Roles
-func displayRoles(roles []Role, flags InputFlags, systemPrefixes []string) {
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+    m := map[string]interface{}{}
+    for {
+        p.skipBlank()
+        if p.pos >= len(p.lines) {
+            break
+        }
+        line := p.lines[p.pos]
+        if line.indent < indent || (line.indent == indent && isYAMLSeqItem(line.text)) {
+            break
+        }
+        if line.indent > indent {
+            return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.num)
+        }
+        key, rest, ok := splitYAMLKey(line.text)
+        if !ok {
+            return nil, fmt.Errorf("yaml: line %d: expected a 'key: value' entry, got %q", line.num, line.text)
+        }
+        p.pos++
+        value, err := p.parseValue(indent, rest, true)
+        if err != nil {
+            return nil, err
+        }
+        m[key] = value
+    }
+    return m, nil
+}
 
-    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
-    fmt.Fprintln(w, "Namespace\tKind\tRole Name\tapiGroups\tResources\tVerbs")
-    fmt.Fprintln(w, "---------\t----\t---------\t---------\t---------\t-----")
-    for _, role := range roles {
-        if flags.ExcludeSystem && isSystemPrefix(role.Metadata.Name, systemPrefixes) {
-            continue
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+    items := []interface{}{}
+    for {
+        p.skipBlank()
+        if p.pos >= len(p.lines) {
+            break
         }
-        displayedHeader := false
-        for _, rule := range role.Rules {
-            for apiGroupIndex, apiGroup := range rule.APIGroups {
-                for resourceIndex, resource := range rule.Resources {
-                    if apiGroupIndex == 0 && !displayedHeader {
-			// if it's a Workspace(a Concept from Kubesphere), do this, because the 'workspace' is not described in Metadata.Namespace
-			workspaceName, exists := role.Metadata.Labels["kubesphere.io/workspace"]
-			if exists {
-	                        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t [%s]\n", workspaceName, role.Kind, role.Metadata.Name, apiGroup, resource, strings.Join(rule.Verbs, ", "))
-        	                displayedHeader = true
-			    } else {
-	                        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t [%s]\n", role.Metadata.Namespace, role.Kind, role.Metadata.Name, apiGroup, resource, strings.Join(rule.Verbs, ", "))
-        	                displayedHeader = true
-			    }
-                    } else if apiGroupIndex == 0 && resourceIndex == 0 { // 첫 번째 apiGroup이지만 resource는 첫 번째가 아닐 경우
-                        fmt.Fprintf(w, "\t\t\t%s\t%s\t [%s]\n", apiGroup, resource, strings.Join(rule.Verbs, ", "))
-                    } else { // 첫 번째 apiGroup이 아닐 경우
-                        fmt.Fprintf(w, "\t\t\t%s\t%s\t\n", apiGroup, resource)
-                    }
-                }
+        line := p.lines[p.pos]
+        if line.indent != indent || !isYAMLSeqItem(line.text) {
+            if line.indent > indent {
+                return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.num)
             }
+            break
         }
-        
-        if displayedHeader {
-            fmt.Fprintln(w, "---------\t----\t---------\t---------\t---------\t-----")
+        content := strings.TrimLeft(line.text[1:], " ")
+        var value interface{}
+        var err error
+        _, _, isKey := splitYAMLKey(content)
+        if content != "" && (isKey || isYAMLSeqItem(content)) {
+            // "- name: x" starts a nested node whose indentation is the column of its content
+            column := indent + len(line.text) - len(content)
+            p.lines[p.pos] = yamlLine{num: line.num, indent: column, text: content, raw: line.raw}
+            value, err = p.parseNode(column)
+        } else {
+            p.pos++
+            value, err = p.parseValue(indent, content, false)
+        }
+        if err != nil {
+            return nil, err
         }
+        items = append(items, value)
     }
-    w.Flush()    
+    return items, nil
 }
 
-// function for drawing a table and displaying Cluster Roles
-func displayClusterRoles(roles []Role, flags InputFlags, systemPrefixes []string) {
-    
-    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
-	fmt.Fprintln(w, "Kind\tRole Name\tapiGroups\tResources\tVerbs")
-	fmt.Fprintln(w, "----\t---------\t---------\t---------\t-----")
+// parses the value that follows "key:" or "- ". parent is the indentation of the owning entry.
+func (p *yamlParser) parseValue(parent int, rest string, inMapping bool) (interface{}, error) {
+    // drop anchors and non-specific tags; aliases are rejected by parseYAMLScalar
+    for strings.HasPrefix(rest, "&") || strings.HasPrefix(rest, "!") {
+        if strings.HasPrefix(rest, "!!str ") {
+            break
+        }
+        if i := strings.IndexByte(rest, ' '); i >= 0 {
+            rest = strings.TrimSpace(rest[i+1:])
+        } else {
+            rest = ""
+        }
+    }
 
-	for _, role := range roles {
-		if flags.ExcludeSystem && isSystemPrefix(role.Metadata.Name, systemPrefixes) {
-			continue
-		}
-		displayedHeader := false
-		for _, rule := range role.Rules {
-			for _, apiGroup := range rule.APIGroups {
-				for _, resource := range rule.Resources {
-					if !displayedHeader {
-						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t [%s]\n", role.Kind, role.Metadata.Name, apiGroup, resource, strings.Join(rule.Verbs, ", "))
-						displayedHeader = true
-					} else {
-						fmt.Fprintf(w, "\t\t%s\t%s\t [%s]\n", apiGroup, resource, strings.Join(rule.Verbs, ", "))
-					}
-				}
-			}
-		}
-		if displayedHeader {
-			fmt.Fprintln(w, "----\t---------\t----------\t---------\t-----")
-		}
-	}
-	w.Flush()
-}
+    if rest == "" {
+        p.skipBlank()
+        if p.pos >= len(p.lines) {
+            return nil, nil
+        }
+        next := p.lines[p.pos]
+        if next.indent > parent {
+            return p.parseNode(next.indent)
+        }
+        if inMapping && next.indent == parent && isYAMLSeqItem(next.text) {
+            // sequences are allowed at the same indentation as their mapping key
+            return p.parseSequence(parent)
+        }
+        return nil, nil
+    }
 
+    if rest[0] == '|' || rest[0] == '>' {
+        return p.parseBlockScalar(parent, rest), nil
+    }
 
-func displayClusterRoleBindings(bindings []RoleBinding, flags InputFlags, systemPrefixes []string) {
-    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+    // flow collections and scalars may continue on more deeply indented lines
+    for p.pos < len(p.lines) {
+        next := p.lines[p.pos]
+        if next.indent >= 0 && next.indent <= parent {
+            break
+        }
+        if (rest[0] == '[' || rest[0] == '{') && flowBalanced(rest) {
+            break
+        }
+        if (rest[0] == '"' || rest[0] == '\'') && closingQuote(rest) > 0 {
+            break
+        }
+        if next.indent < 0 {
+            rest += "\n"
+        } else if strings.HasSuffix(rest, "\n") {
+            rest += next.text
+        } else {
+            rest += " " + next.text
+        }
+        p.pos++
+    }
+    rest = strings.TrimRight(rest, "\n")
 
-    header := "Binding Name\tRole Kind\tLink to (Role Name)\tSubject Kind\tSubject Name\tAllows to (namespace)"
-    if flags.ExtendedOption {
-        header += "\tOwnerReferences (apiVersion, kind, name)"
+    if rest[0] == '[' || rest[0] == '{' {
+        f := &yamlFlow{s: rest}
+        value, err := f.parse()
+        if err != nil {
+            return nil, fmt.Errorf("yaml: line %d: %v", p.lines[p.pos-1].num, err)
+        }
+        return value, nil
     }
-    fmt.Fprintln(w, header)
+    return parseYAMLScalar(rest)
+}
 
-    separator := "------------\t---------\t-------\t------------\t------------\t---------"
-    if flags.ExtendedOption {
-        separator += "\t---------"
+// reports whether every '[' and '{' of a flow collection is closed
+func flowBalanced(s string) bool {
+    depth := 0
+    for i := 0; i < len(s); i++ {
+        switch s[i] {
+        case '"', '\'':
+            end := closingQuote(s[i:])
+            if end < 0 {
+                return false
+            }
+            i += end
+        case '[', '{':
+            depth++
+        case ']', '}':
+            depth--
+        }
     }
-    fmt.Fprintln(w, separator)
+    return depth <= 0
+}
 
-    for _, binding := range bindings {
-        if flags.ExcludeSystem && isSystemPrefix(binding.Metadata.Name, systemPrefixes) {
+// reads a literal (|) or folded (>) block scalar
+func (p *yamlParser) parseBlockScalar(parent int, header string) string {
+    chomp := byte(0)
+    if strings.Contains(header, "-") {
+        chomp = '-'
+    } else if strings.Contains(header, "+") {
+        chomp = '+'
+    }
+
+    var lines []string
+    blockIndent := -1
+    for p.pos < len(p.lines) {
+        line := p.lines[p.pos]
+        if line.indent < 0 {
+            lines = append(lines, "")
+            p.pos++
             continue
         }
+        if line.indent <= parent {
+            break
+        }
+        if blockIndent < 0 {
+            blockIndent = line.indent
+        }
+        raw := strings.TrimRight(line.raw, "\r")
+        if len(raw) > blockIndent {
+            raw = raw[blockIndent:]
+        } else {
+            raw = strings.TrimLeft(raw, " ")
+        }
+        lines = append(lines, raw)
+        p.pos++
+    }
 
-        if len(binding.Subjects) > 0 {
-            namespace := "*"
+    // trailing blank lines belong to the chomping indicator, not to the content
+    trailing := 0
+    for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+        lines = lines[:len(lines)-1]
+        trailing++
+    }
+
+    var text string
+    if header[0] == '>' {
+        var b strings.Builder
+        for i, line := range lines {
+            // an empty line replaces the line break before it; more indented lines keep theirs
+            switch {
+            case line == "":
+                b.WriteString("\n")
+            case i == 0:
+            case strings.HasPrefix(line, " ") || strings.HasPrefix(lines[i-1], " "):
+                b.WriteString("\n")
+            case lines[i-1] == "":
+            default:
+                b.WriteString(" ")
+            }
+            b.WriteString(line)
+        }
+        text = b.String()
+    } else {
+        text = strings.Join(lines, "\n")
+    }
+
+    switch {
+    case len(lines) == 0:
+        return ""
+    case chomp == '-':
+        return text
+    case chomp == '+':
+        return text + "\n" + strings.Repeat("\n", trailing)
+    default:
+        return text + "\n"
+    }
+}
+
+// converts a scalar into a string, bool, number or nil
+func parseYAMLScalar(s string) (interface{}, error) {
+    s = strings.TrimSpace(s)
+    if strings.HasPrefix(s, "!!str ") {
+        value, err := parseYAMLScalar(strings.TrimPrefix(s, "!!str "))
+        if err != nil || value == nil {
+            return "", err
+        }
+        return fmt.Sprint(value), nil
+    }
+    if s == "" {
+        return nil, nil
+    }
+    switch s[0] {
+    case '"':
+        if closingQuote(s) != len(s)-1 {
+            return nil, fmt.Errorf("yaml: unterminated double-quoted string %q", s)
+        }
+        unquoted, err := strconv.Unquote(strings.ReplaceAll(s, `\/`, `/`))
+        if err != nil {
+            // YAML escapes are a superset of Go's; fall back to the raw content
+            return s[1 : len(s)-1], nil
+        }
+        return unquoted, nil
+    case '\'':
+        if closingQuote(s) != len(s)-1 {
+            return nil, fmt.Errorf("yaml: unterminated single-quoted string %q", s)
+        }
+        return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+    }
+    if isYAMLAlias(s) {
+        return nil, fmt.Errorf("yaml: aliases are not supported (%s)", s)
+    }
+    switch s {
+    case "~", "null", "Null", "NULL":
+        return nil, nil
+    case "true", "True", "TRUE":
+        return true, nil
+    case "false", "False", "FALSE":
+        return false, nil
+    }
+    if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+        return n, nil
+    }
+    if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "xXpP") {
+        return f, nil
+    }
+    return s, nil
+}
+
+// "*name" refers to an anchored node, which the reader doesn't keep. "*" alone and "*/scale" are read as strings,
+// as RBAC rules written without quotes expect.
+func isYAMLAlias(s string) bool {
+    if len(s) < 2 || s[0] != '*' {
+        return false
+    }
+    for _, c := range s[1:] {
+        if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+            return false
+        }
+    }
+    return true
+}
+
+// parser for flow collections: [a, b] and {k: v}
+type yamlFlow struct {
+    s string
+    i int
+}
+
+func (f *yamlFlow) skipSpace() {
+    for f.i < len(f.s) && strings.IndexByte(" \t\n", f.s[f.i]) >= 0 {
+        f.i++
+    }
+}
+
+func (f *yamlFlow) parse() (interface{}, error) {
+    f.skipSpace()
+    if f.i >= len(f.s) {
+        return nil, fmt.Errorf("unexpected end of flow collection")
+    }
+    switch f.s[f.i] {
+    case '[':
+        f.i++
+        items := []interface{}{}
+        for {
+            f.skipSpace()
+            if f.i < len(f.s) && f.s[f.i] == ']' {
+                f.i++
+                return items, nil
+            }
+            item, err := f.parse()
+            if err != nil {
+                return nil, err
+            }
+            items = append(items, item)
+            if err := f.endOfEntry(']'); err != nil {
+                return nil, err
+            }
+        }
+    case '{':
+        f.i++
+        m := map[string]interface{}{}
+        for {
+            f.skipSpace()
+            if f.i < len(f.s) && f.s[f.i] == '}' {
+                f.i++
+                return m, nil
+            }
+            key, err := f.scalar(":,}")
+            if err != nil {
+                return nil, err
+            }
+            f.skipSpace()
+            var value interface{}
+            if f.i < len(f.s) && f.s[f.i] == ':' {
+                f.i++
+                if value, err = f.parse(); err != nil {
+                    return nil, err
+                }
+            }
+            m[fmt.Sprint(key)] = value
+            if err := f.endOfEntry('}'); err != nil {
+                return nil, err
+            }
+        }
+    }
+    return f.scalar(",]}")
+}
+
+// consumes the ',' between entries; the closing bracket is left for the caller
+func (f *yamlFlow) endOfEntry(closing byte) error {
+    f.skipSpace()
+    if f.i >= len(f.s) {
+        return fmt.Errorf("missing '%c' in flow collection", closing)
+    }
+    if f.s[f.i] == ',' {
+        f.i++
+        return nil
+    }
+    if f.s[f.i] != closing {
+        return fmt.Errorf("unexpected %q in flow collection", f.s[f.i])
+    }
+    return nil
+}
+
+func (f *yamlFlow) scalar(stops string) (interface{}, error) {
+    f.skipSpace()
+    start := f.i
+    if f.i < len(f.s) && (f.s[f.i] == '"' || f.s[f.i] == '\'') {
+        end := closingQuote(f.s[f.i:])
+        if end < 0 {
+            return nil, fmt.Errorf("unterminated quoted string in flow collection")
+        }
+        f.i += end + 1
+        return parseYAMLScalar(f.s[start:f.i])
+    }
+    for f.i < len(f.s) && strings.IndexByte(stops, f.s[f.i]) < 0 {
+        // in flow context a ':' only separates a key when followed by a space
+        if f.s[f.i] == ':' && f.i+1 < len(f.s) && f.s[f.i+1] != ' ' && strings.IndexByte(stops, ':') >= 0 {
+            f.i++
+            continue
+        }
+        f.i++
+    }
+    return parseYAMLScalar(f.s[start:f.i])
+}
+
+// decodes YAML (or JSON, which is a subset of it) into out using the struct's json tags
+func decodeYAML(data []byte, out interface{}) error {
+    trimmed := strings.TrimSpace(string(data))
+    if strings.HasPrefix(trimmed, "{") {
+        return json.Unmarshal(data, out)
+    }
+    value, err := parseYAML(strings.ReplaceAll(string(data), "\r\n", "\n"))
+    if err != nil {
+        return err
+    }
+    encoded, err := json.Marshal(value)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(encoded, out)
+}
+
+
+// ---------------------------------------------------------------------------------------
+// kubeconfig and the Kubernetes REST client
+// The tool talks to the API server itself, so kubectl does not have to be installed.
+// ---------------------------------------------------------------------------------------
+
+type kubeConfig struct {
+    CurrentContext string                   `json:"current-context"`
+    Clusters       []kubeConfigNamedCluster `json:"clusters"`
+    Contexts       []kubeConfigNamedContext `json:"contexts"`
+    Users          []kubeConfigNamedUser    `json:"users"`
+}
+
+type kubeConfigNamedCluster struct {
+    Name    string            `json:"name"`
+    Cluster kubeConfigCluster `json:"cluster"`
+}
+
+type kubeConfigCluster struct {
+    Server                   string `json:"server"`
+    CertificateAuthority     string `json:"certificate-authority,omitempty"`
+    CertificateAuthorityData string `json:"certificate-authority-data,omitempty"`
+    InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify,omitempty"`
+    TLSServerName            string `json:"tls-server-name,omitempty"`
+    ProxyURL                 string `json:"proxy-url,omitempty"`
+}
+
+type kubeConfigNamedContext struct {
+    Name    string            `json:"name"`
+    Context kubeConfigContext `json:"context"`
+}
+
+type kubeConfigContext struct {
+    Cluster   string `json:"cluster"`
+    User      string `json:"user"`
+    Namespace string `json:"namespace,omitempty"`
+}
+
+type kubeConfigNamedUser struct {
+    Name string         `json:"name"`
+    User kubeConfigUser `json:"user"`
+}
+
+type kubeConfigUser struct {
+    ClientCertificate     string                  `json:"client-certificate,omitempty"`
+    ClientCertificateData string                  `json:"client-certificate-data,omitempty"`
+    ClientKey             string                  `json:"client-key,omitempty"`
+    ClientKeyData         string                  `json:"client-key-data,omitempty"`
+    Token                 string                  `json:"token,omitempty"`
+    TokenFile             string                  `json:"tokenFile,omitempty"`
+    Username              string                  `json:"username,omitempty"`
+    Password              string                  `json:"password,omitempty"`
+    AuthProvider          *kubeConfigAuthProvider `json:"auth-provider,omitempty"`
+    Exec                  *kubeConfigExec         `json:"exec,omitempty"`
+}
+
+// legacy auth providers (oidc, gcp): only the cached token is used
+type kubeConfigAuthProvider struct {
+    Name   string            `json:"name"`
+    Config map[string]string `json:"config"`
+}
+
+// client-go credential plugins (aws, gke-gcloud-auth-plugin, kubelogin, ...)
+type kubeConfigExec struct {
+    APIVersion string   `json:"apiVersion"`
+    Command    string   `json:"command"`
+    Args       []string `json:"args"`
+    Env        []struct {
+        Name  string `json:"name"`
+        Value string `json:"value"`
+    } `json:"env"`
+}
+
+// returns the kubeconfig files to read: the explicit path, $KUBECONFIG, or ~/.kube/config
+func kubeConfigPaths(explicit string) []string {
+    if explicit != "" {
+        return []string{explicit}
+    }
+    if env := os.Getenv("KUBECONFIG"); env != "" {
+        var paths []string
+        for _, path := range filepath.SplitList(env) {
+            if path != "" {
+                paths = append(paths, path)
+            }
+        }
+        return paths
+    }
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return nil
+    }
+    return []string{filepath.Join(home, ".kube", "config")}
+}
+
+// reads and merges kubeconfig files. Like kubectl, the first file to define a name wins.
+func loadKubeConfig(explicit string) (*kubeConfig, error) {
+    merged := &kubeConfig{}
+    loaded := 0
+    for _, path := range kubeConfigPaths(explicit) {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            if os.IsNotExist(err) && explicit == "" {
+                continue
+            }
+            return nil, err
+        }
+        var config kubeConfig
+        if err := decodeYAML(data, &config); err != nil {
+            return nil, fmt.Errorf("%s: %v", path, err)
+        }
+        config.resolvePaths(filepath.Dir(path))
+        loaded++
+
+        if merged.CurrentContext == "" {
+            merged.CurrentContext = config.CurrentContext
+        }
+        for _, cluster := range config.Clusters {
+            if _, ok := merged.cluster(cluster.Name); !ok {
+                merged.Clusters = append(merged.Clusters, cluster)
+            }
+        }
+        for _, context := range config.Contexts {
+            if _, ok := merged.context(context.Name); !ok {
+                merged.Contexts = append(merged.Contexts, context)
+            }
+        }
+        for _, user := range config.Users {
+            if _, ok := merged.user(user.Name); !ok {
+                merged.Users = append(merged.Users, user)
+            }
+        }
+    }
+    if loaded == 0 {
+        return nil, os.ErrNotExist
+    }
+    return merged, nil
+}
+
+// file references in a kubeconfig are relative to the kubeconfig itself
+func (c *kubeConfig) resolvePaths(dir string) {
+    resolve := func(path *string) {
+        if *path != "" && !filepath.IsAbs(*path) {
+            *path = filepath.Join(dir, *path)
+        }
+    }
+    for i := range c.Clusters {
+        resolve(&c.Clusters[i].Cluster.CertificateAuthority)
+    }
+    for i := range c.Users {
+        resolve(&c.Users[i].User.ClientCertificate)
+        resolve(&c.Users[i].User.ClientKey)
+        resolve(&c.Users[i].User.TokenFile)
+    }
+}
+
+func (c *kubeConfig) cluster(name string) (kubeConfigCluster, bool) {
+    for _, cluster := range c.Clusters {
+        if cluster.Name == name {
+            return cluster.Cluster, true
+        }
+    }
+    return kubeConfigCluster{}, false
+}
+
+func (c *kubeConfig) context(name string) (kubeConfigContext, bool) {
+    for _, context := range c.Contexts {
+        if context.Name == name {
+            return context.Context, true
+        }
+    }
+    return kubeConfigContext{}, false
+}
+
+func (c *kubeConfig) user(name string) (kubeConfigUser, bool) {
+    for _, user := range c.Users {
+        if user.Name == name {
+            return user.User, true
+        }
+    }
+    return kubeConfigUser{}, false
+}
+
+type kubeClient struct {
+    Server      string
+    ContextName string
+    ClusterName string
+    Namespace   string // default namespace of the context
+    httpClient  *http.Client
+    bearerToken string
+    username    string
+    password    string
+    ChunkSize   int // items per list request; 0 reads every list in one response
+}
+
+// builds a client from the kubeconfig. Empty arguments mean the default kubeconfig and its current-context.
+// When there is no kubeconfig at all and the tool runs inside a Pod, the Pod's ServiceAccount is used.
+func newKubeClient(kubeconfigPath string, contextName string) (*kubeClient, error) {
+    config, err := loadKubeConfig(kubeconfigPath)
+    if err != nil {
+        if os.IsNotExist(err) && kubeconfigPath == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+            return newInClusterClient()
+        }
+        if os.IsNotExist(err) && kubeconfigPath == "" {
+            return nil, fmt.Errorf("no kubeconfig found (looked in %s)", strings.Join(kubeConfigPaths(""), ", "))
+        }
+        return nil, err
+    }
+
+    if contextName == "" {
+        contextName = config.CurrentContext
+    }
+    if contextName == "" {
+        return nil, fmt.Errorf("kubeconfig has no current-context")
+    }
+    context, ok := config.context(contextName)
+    if !ok {
+        return nil, fmt.Errorf("context %q not found in kubeconfig", contextName)
+    }
+    cluster, ok := config.cluster(context.Cluster)
+    if !ok {
+        return nil, fmt.Errorf("cluster %q (context %q) not found in kubeconfig", context.Cluster, contextName)
+    }
+    user, _ := config.user(context.User)
+
+    if cluster.Server == "" {
+        return nil, fmt.Errorf("cluster %q has no server address", context.Cluster)
+    }
+
+    tlsConfig := &tls.Config{
+        InsecureSkipVerify: cluster.InsecureSkipTLSVerify,
+        ServerName:         cluster.TLSServerName,
+    }
+
+    caData, err := readDataOrFile(cluster.CertificateAuthorityData, cluster.CertificateAuthority)
+    if err != nil {
+        return nil, fmt.Errorf("reading certificate authority: %v", err)
+    }
+    if len(caData) > 0 {
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(caData) {
+            return nil, fmt.Errorf("no valid certificates in the certificate authority of cluster %q", context.Cluster)
+        }
+        tlsConfig.RootCAs = pool
+    }
+
+    client := &kubeClient{
+        Server:      strings.TrimRight(cluster.Server, "/"),
+        ContextName: contextName,
+        ClusterName: context.Cluster,
+        Namespace:   context.Namespace,
+        username:    user.Username,
+        password:    user.Password,
+    }
+
+    certData, err := readDataOrFile(user.ClientCertificateData, user.ClientCertificate)
+    if err != nil {
+        return nil, fmt.Errorf("reading client certificate: %v", err)
+    }
+    keyData, err := readDataOrFile(user.ClientKeyData, user.ClientKey)
+    if err != nil {
+        return nil, fmt.Errorf("reading client key: %v", err)
+    }
+
+    switch {
+    case user.Token != "":
+        client.bearerToken = user.Token
+    case user.TokenFile != "":
+        token, err := os.ReadFile(user.TokenFile)
+        if err != nil {
+            return nil, fmt.Errorf("reading token file: %v", err)
+        }
+        client.bearerToken = strings.TrimSpace(string(token))
+    case user.AuthProvider != nil:
+        for _, key := range []string{"id-token", "access-token"} {
+            if token := user.AuthProvider.Config[key]; token != "" {
+                client.bearerToken = token
+                break
+            }
+        }
+    case user.Exec != nil:
+        token, execCert, execKey, err := runExecCredential(user.Exec)
+        if err != nil {
+            return nil, fmt.Errorf("credential plugin %q: %v", user.Exec.Command, err)
+        }
+        client.bearerToken = token
+        if len(execCert) > 0 {
+            certData, keyData = execCert, execKey
+        }
+    }
+
+    if len(certData) > 0 {
+        certificate, err := tls.X509KeyPair(certData, keyData)
+        if err != nil {
+            return nil, fmt.Errorf("loading client certificate: %v", err)
+        }
+        tlsConfig.Certificates = []tls.Certificate{certificate}
+    }
+
+    transport := &http.Transport{
+        Proxy:           http.ProxyFromEnvironment,
+        TLSClientConfig: tlsConfig,
+    }
+    if cluster.ProxyURL != "" {
+        proxyURL, err := url.Parse(cluster.ProxyURL)
+        if err != nil {
+            return nil, fmt.Errorf("invalid proxy-url: %v", err)
+        }
+        transport.Proxy = http.ProxyURL(proxyURL)
+    }
+    client.httpClient = &http.Client{Transport: transport, Timeout: 2 * time.Minute}
+
+    return client, nil
+}
+
+// uses the ServiceAccount mounted into every Pod
+func newInClusterClient() (*kubeClient, error) {
+    const saDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+    token, err := os.ReadFile(filepath.Join(saDir, "token"))
+    if err != nil {
+        return nil, err
+    }
+    tlsConfig := &tls.Config{}
+    if caData, err := os.ReadFile(filepath.Join(saDir, "ca.crt")); err == nil {
+        pool := x509.NewCertPool()
+        pool.AppendCertsFromPEM(caData)
+        tlsConfig.RootCAs = pool
+    }
+    namespace, _ := os.ReadFile(filepath.Join(saDir, "namespace"))
+
+    host := os.Getenv("KUBERNETES_SERVICE_HOST")
+    if strings.Contains(host, ":") { // IPv6
+        host = "[" + host + "]"
+    }
+    return &kubeClient{
+        Server:      "https://" + host + ":" + os.Getenv("KUBERNETES_SERVICE_PORT"),
+        ContextName: "in-cluster",
+        ClusterName: "in-cluster",
+        Namespace:   strings.TrimSpace(string(namespace)),
+        httpClient:  &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: 2 * time.Minute},
+        bearerToken: strings.TrimSpace(string(token)),
+    }, nil
+}
+
+// kubeconfig fields come in pairs: inline base64 data, or a path to a file
+func readDataOrFile(data string, path string) ([]byte, error) {
+    if data != "" {
+        return base64.StdEncoding.DecodeString(data)
+    }
+    if path != "" {
+        return os.ReadFile(path)
+    }
+    return nil, nil
+}
+
+// runs a client-go credential plugin and returns the credentials from its ExecCredential status
+func runExecCredential(plugin *kubeConfigExec) (string, []byte, []byte, error) {
+    cmd := exec.Command(plugin.Command, plugin.Args...)
+    cmd.Env = os.Environ()
+    for _, env := range plugin.Env {
+        cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+    }
+    cmd.Env = append(cmd.Env, fmt.Sprintf(`KUBERNETES_EXEC_INFO={"apiVersion":%q,"kind":"ExecCredential","spec":{"interactive":false}}`, plugin.APIVersion))
+    cmd.Stderr = os.Stderr
+
+    output, err := cmd.Output()
+    if err != nil {
+        return "", nil, nil, err
+    }
+    var credential struct {
+        Status struct {
+            Token                 string `json:"token"`
+            ClientCertificateData string `json:"clientCertificateData"`
+            ClientKeyData         string `json:"clientKeyData"`
+        } `json:"status"`
+    }
+    if err := json.Unmarshal(output, &credential); err != nil {
+        return "", nil, nil, fmt.Errorf("invalid ExecCredential output: %v", err)
+    }
+    status := credential.Status
+    return status.Token, []byte(status.ClientCertificateData), []byte(status.ClientKeyData), nil
+}
+
+// sends a GET request to the API server and returns the response body of a successful request
+func (c *kubeClient) get(ctx context.Context, path string) (io.ReadCloser, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", c.Server+path, nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Accept", "application/json")
+    req.Header.Set("User-Agent", "rbac-tool/"+Version)
+    if c.bearerToken != "" {
+        req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+    } else if c.username != "" {
+        req.SetBasicAuth(c.username, c.password)
+    }
+
+    resp, err := c.httpClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        defer resp.Body.Close()
+        body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+        // the API server explains errors with a Status object
+        var status struct {
+            Message string `json:"message"`
+        }
+        message := strings.TrimSpace(string(body))
+        if json.Unmarshal(body, &status) == nil && status.Message != "" {
+            message = status.Message
+        }
+        return nil, &apiError{Path: path, StatusCode: resp.StatusCode, Message: message}
+    }
+    return resp.Body, nil
+}
+
+// an error response of the API server
+type apiError struct {
+    Path       string
+    StatusCode int
+    Message    string
+}
+
+func (e *apiError) Error() string {
+    return fmt.Sprintf("GET %s: %s (HTTP %d)", e.Path, e.Message, e.StatusCode)
+}
+
+// reports whether the API server doesn't serve the requested resource (e.g. KubeSphere kinds on plain Kubernetes)
+func isNotFound(err error) bool {
+    apiErr, ok := err.(*apiError)
+    return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+func (c *kubeClient) getJSON(ctx context.Context, path string, out interface{}) error {
+    body, err := c.get(ctx, path)
+    if err != nil {
+        return err
+    }
+    defer body.Close()
+    if err := json.NewDecoder(body).Decode(out); err != nil {
+        return fmt.Errorf("GET %s: decoding response: %v", path, err)
+    }
+    return nil
+}
+
+
+// metadata of a list response
+type listMeta struct {
+    Continue           string `json:"continue"`
+    RemainingItemCount *int64 `json:"remainingItemCount,omitempty"`
+}
+
+// lists a collection page by page (limit/continue) and hands every item to visit as soon as it is decoded,
+// so a large list is never held in memory as one document. label names the collection in progress messages.
+func (c *kubeClient) list(ctx context.Context, path string, label string, visit func(item json.RawMessage) error) error {
+    continueToken := ""
+    total := 0
+    for page := 1; ; page++ {
+        query := url.Values{}
+        if c.ChunkSize > 0 {
+            query.Set("limit", strconv.Itoa(c.ChunkSize))
+        }
+        if continueToken != "" {
+            query.Set("continue", continueToken)
+        }
+        pagePath := path
+        if len(query) > 0 {
+            pagePath += "?" + query.Encode()
+        }
+
+        body, err := c.get(ctx, pagePath)
+        if err != nil {
+            if apiErr, ok := err.(*apiError); ok && apiErr.StatusCode == http.StatusGone && continueToken != "" {
+                return fmt.Errorf("listing %s: the list changed too much while it was being read (%s); run again, or use a larger --chunk-size", label, apiErr.Message)
+            }
+            return err
+        }
+        count, metadata, err := decodeListStream(body, visit)
+        body.Close()
+        if err != nil {
+            return fmt.Errorf("GET %s: %v", path, err)
+        }
+        total += count
+
+        continueToken = metadata.Continue
+        if continueToken == "" {
+            if page > 1 {
+                fmt.Fprintf(os.Stderr, "Fetched %s: %d items in %d pages\n", label, total, page)
+            }
+            return nil
+        }
+        if metadata.RemainingItemCount != nil {
+            fmt.Fprintf(os.Stderr, "Fetching %s: %d items, about %d remaining\n", label, total, *metadata.RemainingItemCount)
+        } else {
+            fmt.Fprintf(os.Stderr, "Fetching %s: %d items\n", label, total)
+        }
+    }
+}
+
+// reads a list response token by token: items are passed to visit one at a time, and the list metadata is returned
+func decodeListStream(r io.Reader, visit func(item json.RawMessage) error) (int, listMeta, error) {
+    var metadata listMeta
+    count := 0
+    decoder := json.NewDecoder(r)
+
+    if token, err := decoder.Token(); err != nil {
+        return 0, metadata, err
+    } else if delim, ok := token.(json.Delim); !ok || delim != '{' {
+        return 0, metadata, fmt.Errorf("expected a JSON object, got %v", token)
+    }
+    for decoder.More() {
+        token, err := decoder.Token()
+        if err != nil {
+            return count, metadata, err
+        }
+        switch token {
+        case "metadata":
+            if err := decoder.Decode(&metadata); err != nil {
+                return count, metadata, err
+            }
+        case "items":
+            token, err := decoder.Token()
+            if err != nil {
+                return count, metadata, err
+            }
+            if token == nil { // "items": null
+                continue
+            }
+            if delim, ok := token.(json.Delim); !ok || delim != '[' {
+                return count, metadata, fmt.Errorf("expected an items array, got %v", token)
+            }
+            for decoder.More() {
+                var item json.RawMessage
+                if err := decoder.Decode(&item); err != nil {
+                    return count, metadata, err
+                }
+                count++
+                if err := visit(item); err != nil {
+                    return count, metadata, err
+                }
+            }
+            if _, err := decoder.Token(); err != nil { // closing ']'
+                return count, metadata, err
+            }
+        default:
+            var skipped json.RawMessage
+            if err := decoder.Decode(&skipped); err != nil {
+                return count, metadata, err
+            }
+        }
+    }
+    return count, metadata, nil
+}
+
+
+// Structures for API discovery (/api, /apis)
+type APIGroupList struct {
+    Groups []APIGroup `json:"groups"`
+}
+
+type APIGroup struct {
+    Name             string                     `json:"name"`
+    Versions         []GroupVersionForDiscovery `json:"versions"`
+    PreferredVersion GroupVersionForDiscovery   `json:"preferredVersion"`
+}
+
+type GroupVersionForDiscovery struct {
+    GroupVersion string `json:"groupVersion"`
+    Version      string `json:"version"`
+}
+
+type APIResourceList struct {
+    GroupVersion string        `json:"groupVersion"`
+    Resources    []APIResource `json:"resources"`
+}
+
+type APIResource struct {
+    Name       string   `json:"name"`
+    Namespaced bool     `json:"namespaced"`
+    Kind       string   `json:"kind"`
+    Verbs      []string `json:"verbs"`
+    ShortNames []string `json:"shortNames,omitempty"`
+}
+
+// returns the resource lists of the core group and the preferred version of every API group,
+// which is what 'kubectl api-resources' shows. Groups that fail discovery are reported and skipped.
+func discoverAPIResources(ctx context.Context, client *kubeClient) ([]APIResourceList, error) {
+    var core APIResourceList
+    if err := client.getJSON(ctx, "/api/v1", &core); err != nil {
+        return nil, err
+    }
+
+    var groups APIGroupList
+    if err := client.getJSON(ctx, "/apis", &groups); err != nil {
+        return nil, err
+    }
+    groupLists := make([]*APIResourceList, len(groups.Groups))
+    var tasks []func(ctx context.Context) error
+    for i, group := range groups.Groups {
+        i, group := i, group
+        tasks = append(tasks, func(ctx context.Context) error {
+            var list APIResourceList
+            if err := client.getJSON(ctx, "/apis/"+group.PreferredVersion.GroupVersion, &list); err != nil {
+                fmt.Fprintln(os.Stderr, "Warning: skipping API group", group.Name+":", err)
+                return nil
+            }
+            groupLists[i] = &list
+            return nil
+        })
+    }
+    if err := runConcurrently(ctx, tasks); err != nil {
+        return nil, err
+    }
+
+    lists := []APIResourceList{core}
+    for _, list := range groupLists {
+        if list != nil {
+            lists = append(lists, *list)
+        }
+    }
+    return lists, nil
+}
+
+
+// reads an API discovery dump: a JSON array of APIResourceList objects, like discovery.json in a snapshot archive
+func loadDiscovery(path string) ([]APIResourceList, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var lists []APIResourceList
+    if err := json.Unmarshal(data, &lists); err != nil {
+        return nil, fmt.Errorf("%s is not an API discovery dump: %v", path, err)
+    }
+    return lists, nil
+}
+
+// the API group of a discovery GroupVersion: "" for "v1", "apps" for "apps/v1"
+func groupOf(groupVersion string) string {
+    if slash := strings.Index(groupVersion, "/"); slash >= 0 {
+        return groupVersion[:slash]
+    }
+    return ""
+}
+
+// Expands wildcard apiGroups and resources into one rule per concrete resource or subresource the discovery data
+// knows, CRDs included. "*/scale" stands for the scale subresource of every resource, as in the API server.
+// Rules without wildcards are returned unchanged; the caller merges the result again.
+func expandRules(rules []RoleRule, lists []APIResourceList) []RoleRule {
+    var expanded []RoleRule
+    for _, rule := range rules {
+        for _, apiGroup := range rule.APIGroups {
+            for _, resource := range rule.Resources {
+                wildcard := apiGroup == "*" || resource == "*" || strings.HasPrefix(resource, "*/")
+                if !wildcard {
+                    expanded = append(expanded, RoleRule{APIGroups: []string{apiGroup}, Resources: []string{resource}, ResourceNames: rule.ResourceNames, Verbs: rule.Verbs})
+                    continue
+                }
+                matched := false
+                for _, list := range lists {
+                    group := groupOf(list.GroupVersion)
+                    if apiGroup != "*" && apiGroup != group {
+                        continue
+                    }
+                    for _, candidate := range list.Resources {
+                        switch {
+                        case resource == "*":
+                        case strings.HasPrefix(resource, "*/"):
+                            if !strings.HasSuffix(candidate.Name, resource[1:]) {
+                                continue
+                            }
+                        case candidate.Name != resource:
+                            continue
+                        }
+                        expanded = append(expanded, RoleRule{APIGroups: []string{group}, Resources: []string{candidate.Name}, ResourceNames: rule.ResourceNames, Verbs: rule.Verbs})
+                        matched = true
+                    }
+                }
+                // nothing served matches (e.g. a CRD that isn't installed yet): keep the rule as written, so the
+                // access it grants once the resource exists isn't lost
+                if !matched {
+                    expanded = append(expanded, RoleRule{APIGroups: []string{apiGroup}, Resources: []string{resource}, ResourceNames: rule.ResourceNames, Verbs: rule.Verbs})
+                }
+            }
+        }
+        if len(rule.NonResourceURLs) > 0 {
+            expanded = append(expanded, RoleRule{NonResourceURLs: rule.NonResourceURLs, Verbs: rule.Verbs})
+        }
+    }
+    return expanded
+}
+
+// ---------------------------------------------------------------------------------------
+// RBAC data sources
+// Objects come either from a live cluster or from YAML/JSON files (--from), e.g. 'kubectl get -o yaml' dumps.
+// ---------------------------------------------------------------------------------------
+
+// describes a kind the tool reads, keyed by its resource name in rbacKinds
+type resourceKind struct {
+    Kind             string // e.g. "ClusterRole"
+    GroupVersionPath string // e.g. "/apis/rbac.authorization.k8s.io/v1"
+    Namespaced       bool
+}
+
+var rbacKinds = map[string]resourceKind{
+    "roles":                 {"Role", "/apis/rbac.authorization.k8s.io/v1", true},
+    "clusterroles":          {"ClusterRole", "/apis/rbac.authorization.k8s.io/v1", false},
+    "rolebindings":          {"RoleBinding", "/apis/rbac.authorization.k8s.io/v1", true},
+    "clusterrolebindings":   {"ClusterRoleBinding", "/apis/rbac.authorization.k8s.io/v1", false},
+    "workspaceroles":        {"WorkspaceRole", "/apis/iam.kubesphere.io/v1alpha2", false},
+    "workspacerolebindings": {"WorkspaceRoleBinding", "/apis/iam.kubesphere.io/v1alpha2", false},
+    "globalroles":           {"GlobalRole", "/apis/iam.kubesphere.io/v1alpha2", false},
+    "globalrolebindings":    {"GlobalRoleBinding", "/apis/iam.kubesphere.io/v1alpha2", false},
+    // only read by 'get orphans'
+    "serviceaccounts":       {"ServiceAccount", "/api/v1", true},
+    "namespaces":            {"Namespace", "/api/v1", false},
+}
+
+var kubernetesRBACKinds = []string{"roles", "clusterroles", "rolebindings", "clusterrolebindings"}
+var kubeSphereRBACKinds = []string{"workspaceroles", "globalroles", "workspacerolebindings", "globalrolebindings"}
+
+// returns the resource name of a kind ("ClusterRole" -> "clusterroles"), or "" for kinds the tool doesn't read
+func resourceForKind(kind string) string {
+    for resource, k := range rbacKinds {
+        if k.Kind == kind {
+            return resource
+        }
+    }
+    return ""
+}
+
+type rbacSource struct {
+    client    *kubeClient                  // live cluster; nil in offline mode
+    objects   map[string][]json.RawMessage // offline objects keyed by resource name
+    snapshot  *snapshotMetadata            // set when the objects come from a snapshot archive
+    discovery []APIResourceList            // discovery data from --discovery or the snapshot; nil means ask the cluster
+}
+
+// returns the live source for the selected kubeconfig context, or the offline source when --from or --snapshot is given
+func newRBACSource(flags InputFlags) (*rbacSource, error) {
+    source := &rbacSource{}
+    switch {
+    case flags.Snapshot != "":
+        objects, metadata, discovery, err := loadSnapshot(flags.Snapshot)
+        if err != nil {
+            return nil, err
+        }
+        source.objects, source.snapshot, source.discovery = objects, metadata, discovery
+    case flags.From != "":
+        objects, err := loadOfflineObjects(flags.From)
+        if err != nil {
+            return nil, err
+        }
+        source.objects = objects
+    default:
+        client, err := newKubeClient(flags.Kubeconfig, flags.Context)
+        if err != nil {
+            return nil, err
+        }
+        client.ChunkSize = flags.ChunkSize
+        source.client = client
+    }
+    if flags.Discovery != "" {
+        discovery, err := loadDiscovery(flags.Discovery)
+        if err != nil {
+            return nil, err
+        }
+        source.discovery = discovery
+    }
+    return source, nil
+}
+
+// the discovery data of a source: the dump it was given, or what the live cluster reports
+func apiResources(ctx context.Context, source *rbacSource) ([]APIResourceList, error) {
+    if source.discovery != nil {
+        return source.discovery, nil
+    }
+    if source.client == nil {
+        return nil, fmt.Errorf("no discovery data offline; pass an API discovery dump with --discovery, or use a snapshot that contains one")
+    }
+    return discoverAPIResources(ctx, source.client)
+}
+
+// --expand: replaces wildcard rules of all roles by the concrete resources they cover. Discovery data is only read
+// when some rule has a wildcard.
+func expandRBACData(ctx context.Context, source *rbacSource, data *rbacData) error {
+    roleLists := [][]Role{data.Roles, data.ClusterRoles, data.WorkspaceRoles, data.GlobalRoles}
+    wildcards := false
+    for _, roles := range roleLists {
+        for _, role := range roles {
+            for _, rule := range role.Rules {
+                for _, cell := range ruleCells(rule) {
+                    if strings.HasPrefix(cell[0], "*") || strings.HasPrefix(cell[1], "*") {
+                        wildcards = true
+                    }
+                }
+            }
+        }
+    }
+    if !wildcards {
+        return nil
+    }
+    lists, err := apiResources(ctx, source)
+    if err != nil {
+        return err
+    }
+    for _, roles := range roleLists {
+        for i := range roles {
+            roles[i].Rules = mergeRules(expandRules(roles[i].Rules, lists))
+            sort.Sort(SortByAPIGroup(roles[i].Rules))
+        }
+    }
+    return nil
+}
+
+// builds the list path of a namespaced resource, across all namespaces when namespace is empty
+func namespacedPath(groupVersionPath string, namespace string, resource string) string {
+    if namespace == "" {
+        return groupVersionPath + "/" + resource
+    }
+    return groupVersionPath + "/namespaces/" + url.PathEscape(namespace) + "/" + resource
+}
+
+// calls visit for every object of the given resource. namespace limits namespaced kinds to one namespace.
+func (s *rbacSource) each(ctx context.Context, resource string, namespace string, visit func(item json.RawMessage) error) error {
+    kind, ok := rbacKinds[resource]
+    if !ok {
+        return fmt.Errorf("unknown resource type: %s", resource)
+    }
+    if !kind.Namespaced {
+        namespace = ""
+    }
+
+    if s.client == nil {
+        for _, item := range s.objects[resource] {
+            if err := ctx.Err(); err != nil {
+                return err
+            }
+            if namespace != "" {
+                var object struct {
+                    Metadata struct {
+                        Namespace string `json:"namespace"`
+                    } `json:"metadata"`
+                }
+                json.Unmarshal(item, &object)
+                if object.Metadata.Namespace != namespace {
+                    continue
+                }
+            }
+            if err := visit(item); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    path := kind.GroupVersionPath + "/" + resource
+    if kind.Namespaced {
+        path = namespacedPath(kind.GroupVersionPath, namespace, resource)
+    }
+    return s.client.list(ctx, path, resource, visit)
+}
+
+// reads RBAC objects from a file, every manifest file under a directory, or stdin ("-").
+// Single objects, List objects (kind: List, RoleList, ...) and multi-document YAML are accepted.
+// Objects of other kinds are ignored, so full cluster dumps can be used as-is.
+func loadOfflineObjects(path string) (map[string][]json.RawMessage, error) {
+    objects := make(map[string][]json.RawMessage)
+
+    if path == "-" {
+        data, err := io.ReadAll(os.Stdin)
+        if err != nil {
+            return nil, err
+        }
+        if err := addManifests(objects, data); err != nil {
+            return nil, fmt.Errorf("stdin: %v", err)
+        }
+        return objects, nil
+    }
+
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, err
+    }
+    if !info.IsDir() {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return nil, err
+        }
+        if err := addManifests(objects, data); err != nil {
+            return nil, fmt.Errorf("%s: %v", path, err)
+        }
+        return objects, nil
+    }
+
+    err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.IsDir() {
+            return nil
+        }
+        switch strings.ToLower(filepath.Ext(file)) {
+        case ".yaml", ".yml", ".json":
+        default:
+            return nil
+        }
+        data, err := os.ReadFile(file)
+        if err != nil {
+            return err
+        }
+        if err := addManifests(objects, data); err != nil {
+            return fmt.Errorf("%s: %v", file, err)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return objects, nil
+}
+
+// parses one manifest file (JSON or YAML, possibly several documents) and sorts its objects by kind
+func addManifests(objects map[string][]json.RawMessage, data []byte) error {
+    trimmed := strings.TrimSpace(string(data))
+    if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+        // a stream of JSON values, as written by 'kubectl get -o json'
+        decoder := json.NewDecoder(strings.NewReader(trimmed))
+        for decoder.More() {
+            var raw json.RawMessage
+            if err := decoder.Decode(&raw); err != nil {
+                return err
+            }
+            if err := addObject(objects, raw, ""); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    documents, err := parseYAMLDocuments(data)
+    if err != nil {
+        return err
+    }
+    for _, document := range documents {
+        raw, err := json.Marshal(document)
+        if err != nil {
+            return err
+        }
+        if err := addObject(objects, raw, ""); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// files one object under its resource name. Lists are unpacked; items of typed lists
+// such as RoleList may omit their kind, so the list's kind is used for them.
+func addObject(objects map[string][]json.RawMessage, raw json.RawMessage, defaultKind string) error {
+    if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+        var items []json.RawMessage
+        if err := json.Unmarshal(raw, &items); err != nil {
+            return err
+        }
+        for _, item := range items {
+            if err := addObject(objects, item, defaultKind); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    var header struct {
+        Kind  string            `json:"kind"`
+        Items []json.RawMessage `json:"items"`
+    }
+    if err := json.Unmarshal(raw, &header); err != nil {
+        return err
+    }
+    if strings.HasSuffix(header.Kind, "List") || (header.Kind == "" && header.Items != nil) {
+        itemKind := strings.TrimSuffix(header.Kind, "List")
+        for _, item := range header.Items {
+            if err := addObject(objects, item, itemKind); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    kind := header.Kind
+    if kind == "" {
+        kind = defaultKind
+    }
+    if resource := resourceForKind(kind); resource != "" {
+        objects[resource] = append(objects[resource], raw)
+    }
+    return nil
+}
+
+// all RBAC objects of one source. Kinds that were not fetched are left empty.
+type rbacData struct {
+    Roles                 []Role
+    ClusterRoles          []Role
+    RoleBindings          []RoleBinding
+    ClusterRoleBindings   []RoleBinding
+    WorkspaceRoles        []Role
+    GlobalRoles           []Role
+    WorkspaceRoleBindings []RoleBinding
+    GlobalRoleBindings    []RoleBinding
+    ServiceAccounts       []namedObject
+    Namespaces            []namedObject
+}
+
+// ServiceAccounts and Namespaces only matter by name
+type namedObject struct {
+    Metadata struct {
+        Name      string `json:"name"`
+        Namespace string `json:"namespace,omitempty"`
+    } `json:"metadata"`
+}
+
+// runs the tasks concurrently. The first error cancels the context of the others and is returned.
+func runConcurrently(ctx context.Context, tasks []func(ctx context.Context) error) error {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    var wg sync.WaitGroup
+    var once sync.Once
+    var firstErr error
+    for _, task := range tasks {
+        wg.Add(1)
+        go func(task func(ctx context.Context) error) {
+            defer wg.Done()
+            if err := task(ctx); err != nil {
+                once.Do(func() {
+                    firstErr = err
+                    cancel()
+                })
+            }
+        }(task)
+    }
+    wg.Wait()
+    return firstErr
+}
+
+// fetches the given resources concurrently. A missing optional resource (e.g. KubeSphere kinds on
+// a plain Kubernetes cluster) is left empty; any other error stops the remaining fetches.
+func fetchRBACData(ctx context.Context, source *rbacSource, resources []string, optional []string, namespace string) (*rbacData, error) {
+    data := &rbacData{}
+    roleTargets := map[string]*[]Role{
+        "roles":          &data.Roles,
+        "clusterroles":   &data.ClusterRoles,
+        "workspaceroles": &data.WorkspaceRoles,
+        "globalroles":    &data.GlobalRoles,
+    }
+    bindingTargets := map[string]*[]RoleBinding{
+        "rolebindings":          &data.RoleBindings,
+        "clusterrolebindings":   &data.ClusterRoleBindings,
+        "workspacerolebindings": &data.WorkspaceRoleBindings,
+        "globalrolebindings":    &data.GlobalRoleBindings,
+    }
+    objectTargets := map[string]*[]namedObject{
+        "serviceaccounts": &data.ServiceAccounts,
+        "namespaces":      &data.Namespaces,
+    }
+
+    var tasks []func(ctx context.Context) error
+    addTasks := func(list []string, isOptional bool) {
+        for _, resource := range list {
+            resource := resource
+            tasks = append(tasks, func(ctx context.Context) error {
+                var err error
+                // every task writes to its own field of data
+                if target, ok := roleTargets[resource]; ok {
+                    *target, err = storeKubernetesRoles(ctx, source, resource, namespace)
+                } else if target, ok := bindingTargets[resource]; ok {
+                    *target, err = storeBindings(ctx, source, resource, namespace)
+                } else if target, ok := objectTargets[resource]; ok {
+                    err = source.each(ctx, resource, namespace, func(item json.RawMessage) error {
+                        var object namedObject
+                        if err := json.Unmarshal(item, &object); err != nil {
+                            return err
+                        }
+                        *target = append(*target, object)
+                        return nil
+                    })
+                } else {
+                    err = fmt.Errorf("unknown resource type: %s", resource)
+                }
+                if err != nil && !(isOptional && isNotFound(err)) {
+                    return fmt.Errorf("getting %s data: %v", rbacKinds[resource].Kind, err)
+                }
+                return nil
+            })
+        }
+    }
+    addTasks(resources, false)
+    addTasks(optional, true)
+
+    if err := runConcurrently(ctx, tasks); err != nil {
+        return nil, err
+    }
+    return data, nil
+}
+
+// the resources a command works on, so nothing else is fetched
+func requiredKinds(flags InputFlags) []string {
+    switch flags.CommandType {
+    case "show":
+        if flags.ResourceType == "table" {
+            return []string{flags.TableType + "s"}
+        }
+        return nil // show core / show verbs only read discovery data
+    case "check", "who-can", "escalation-paths", "lint", "benchmark":
+        return kubernetesRBACKinds
+    case "get":
+        if flags.ResourceType == "orphans" || flags.ResourceType == "csv" && flags.CSVType == "orphans" {
+            return []string{"roles", "clusterroles", "rolebindings", "clusterrolebindings", "serviceaccounts", "namespaces"}
+        }
+        if flags.ResourceType == "csv" && flags.CSVType != "user" {
+            return nil
+        }
+        if flags.ResourceType != "user" && flags.ResourceType != "csv" {
+            return nil
+        }
+        only := make(map[string]bool)
+        for _, option := range flags.OnlyOption {
+            only[option] = true
+        }
+        var kinds []string
+        if len(flags.OnlyOption) == 0 || only["clusterrolebinding"] {
+            kinds = append(kinds, "clusterrolebindings")
+        }
+        if len(flags.OnlyOption) == 0 || only["rolebinding"] {
+            kinds = append(kinds, "rolebindings")
+        }
+        if flags.KubeSphere {
+            if only["workspacerolebinding"] {
+                kinds = append(kinds, "workspacerolebindings")
+            }
+            if only["globalrolebinding"] {
+                kinds = append(kinds, "globalrolebindings")
+            }
+        }
+        if flags.MoreOption || flags.Overpowered {
+            // rules are attached from the roles the bindings refer to
+            kinds = append(kinds, "clusterroles", "roles")
+            if flags.KubeSphere {
+                kinds = append(kinds, "workspaceroles", "globalroles")
+            }
+        }
+        return kinds
+    }
+    return nil
+}
+
+// reports whether the labels satisfy the selector. Like the API server, an empty selector matches everything.
+func (selector LabelSelector) matches(labels map[string]string) bool {
+    for key, value := range selector.MatchLabels {
+        if actual, ok := labels[key]; !ok || actual != value {
+            return false
+        }
+    }
+    for _, requirement := range selector.MatchExpressions {
+        actual, ok := labels[requirement.Key]
+        in := false
+        for _, value := range requirement.Values {
+            if ok && actual == value {
+                in = true
+            }
+        }
+        switch requirement.Operator {
+        case "In":
+            if !in {
+                return false
+            }
+        case "NotIn":
+            if in {
+                return false
+            }
+        case "Exists":
+            if !ok {
+                return false
+            }
+        case "DoesNotExist":
+            if ok {
+                return false
+            }
+        default:
+            return false // unknown operators never match, as in the API server
+        }
+    }
+    return true
+}
+
+// Recomputes the rules of aggregated ClusterRoles from the ClusterRoles their selectors match, instead of trusting the
+// rules field: offline files and freshly created aggregations don't have the aggregated rules yet.
+// Rules already stored in the aggregate are kept, so an input that lacks the labelled roles loses nothing.
+// Aggregates may contribute to other aggregates (view -> edit -> admin), so contributors are resolved first;
+// a contributor that is part of a cycle adds the rules it has so far.
+func aggregateClusterRoles(roles []Role) {
+    contributors := make(map[int][]int)
+    for i := range roles {
+        if roles[i].AggregationRule == nil {
+            continue
+        }
+        for j, candidate := range roles {
+            if i == j {
+                continue
+            }
+            for _, selector := range roles[i].AggregationRule.ClusterRoleSelectors {
+                if selector.matches(candidate.Metadata.Labels) {
+                    contributors[i] = append(contributors[i], j)
+                    break
+                }
+            }
+        }
+        sort.Slice(contributors[i], func(a, b int) bool {
+            return roles[contributors[i][a]].Metadata.Name < roles[contributors[i][b]].Metadata.Name
+        })
+    }
+
+    const resolving, resolved = 1, 2
+    state := make(map[int]int)
+    var resolve func(i int)
+    resolve = func(i int) {
+        if state[i] != 0 {
+            return
+        }
+        state[i] = resolving
+        rules := roles[i].Rules
+        for _, j := range contributors[i] {
+            resolve(j)
+            roles[i].AggregatedFrom = append(roles[i].AggregatedFrom, roles[j].Metadata.Name)
+            rules = append(rules, roles[j].Rules...)
+        }
+        roles[i].Rules = rules
+        state[i] = resolved
+    }
+    for i := range roles {
+        if roles[i].AggregationRule != nil {
+            resolve(i)
+        }
+    }
+}
+
+// Collects all Roles and Cluster Roles. In addition, it also collects Workspace Roles and Global Roles. It's the Kubesphere-specific role type.
+// namespace limits namespaced kinds to a single namespace ("" means all namespaces).
+func storeKubernetesRoles(ctx context.Context, source *rbacSource, roleType string, namespace string) ([]Role, error) {
+    switch roleType {
+    case "roles", "workspaceroles", "clusterroles", "globalroles":
+    default:
+        return nil, fmt.Errorf("Invalid role type: %s", roleType)
+    }
+
+    var roles []Role
+    err := source.each(ctx, roleType, namespace, func(item json.RawMessage) error {
+        var role Role
+        if err := json.Unmarshal(item, &role); err != nil {
+            return err
+        }
+        roles = append(roles, role)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    if roleType == "clusterroles" {
+        aggregateClusterRoles(roles)
+    }
+
+    // apiGroups 정렬 및 Verbs 병합
+    for i := range roles {
+        roles[i].Rules = mergeRules(roles[i].Rules)
+        sort.Sort(SortByAPIGroup(roles[i].Rules))
+    }
+
+    return roles, nil
+}
+
+
+func storeBindings(ctx context.Context, source *rbacSource, resourceType string, namespace string) ([]RoleBinding, error) {
+    switch resourceType {
+    case "clusterrolebindings", "rolebindings", "workspacerolebindings", "globalrolebindings":
+    default:
+        return nil, fmt.Errorf("invalid resource type: %s", resourceType)
+    }
+
+    var bindings []RoleBinding
+    err := source.each(ctx, resourceType, namespace, func(item json.RawMessage) error {
+        var binding RoleBinding
+        if err := json.Unmarshal(item, &binding); err != nil {
+            return err
+        }
+        bindings = append(bindings, binding)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return bindings, nil
+}
+
+
+// ---------------------------------------------------------------------------------------
+// Snapshots
+// 'snapshot save' writes every RBAC object of a cluster into one .tar.gz archive, so an audit can be
+// reproduced later with --snapshot against exactly the captured data.
+// The archive holds metadata.json and one List file per kind (<resource>.json); extracted, it also works with --from.
+// ---------------------------------------------------------------------------------------
+
+const snapshotFormatVersion = 1
+
+type snapshotMetadata struct {
+    SnapshotVersion int            `json:"snapshotVersion"`
+    ToolVersion     string         `json:"toolVersion"`
+    CapturedAt      string         `json:"capturedAt"` // RFC 3339
+    Cluster         string         `json:"cluster"`
+    Context         string         `json:"context,omitempty"`
+    Server          string         `json:"server,omitempty"`
+    ServerVersion   string         `json:"serverVersion,omitempty"`
+    Namespace       string         `json:"namespace,omitempty"` // set when the capture was limited with --namespace
+    Kinds           map[string]int `json:"kinds"`               // number of objects per resource
+}
+
+// the order kinds are written in; KubeSphere kinds are only captured when the cluster serves them
+var snapshotKinds = []string{"roles", "clusterroles", "rolebindings", "clusterrolebindings", "workspaceroles", "globalroles", "workspacerolebindings", "globalrolebindings"}
+
+func isKubeSphereKind(resource string) bool {
+    return strings.HasPrefix(rbacKinds[resource].GroupVersionPath, "/apis/iam.kubesphere.io/")
+}
+
+// returns the API server's version, e.g. "v1.29.3"
+func (c *kubeClient) serverVersion(ctx context.Context) (string, error) {
+    var info struct {
+        GitVersion string `json:"gitVersion"`
+    }
+    if err := c.getJSON(ctx, "/version", &info); err != nil {
+        return "", err
+    }
+    return info.GitVersion, nil
+}
+
+func saveSnapshot(ctx context.Context, source *rbacSource, flags InputFlags, path string) error {
+    metadata := snapshotMetadata{
+        SnapshotVersion: snapshotFormatVersion,
+        ToolVersion:     Version,
+        CapturedAt:      time.Now().UTC().Format(time.RFC3339),
+        Namespace:       flags.Namespace,
+        Kinds:           make(map[string]int),
+    }
+    switch {
+    case source.client != nil:
+        metadata.Cluster = source.client.ClusterName
+        metadata.Context = source.client.ContextName
+        metadata.Server = source.client.Server
+        version, err := source.client.serverVersion(ctx)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Warning: cannot read the server version:", err)
+        }
+        metadata.ServerVersion = version
+    case source.snapshot != nil:
+        // re-saving keeps the origin of the data
+        metadata.Cluster = source.snapshot.Cluster
+        metadata.Context = source.snapshot.Context
+        metadata.Server = source.snapshot.Server
+        metadata.ServerVersion = source.snapshot.ServerVersion
+        metadata.CapturedAt = source.snapshot.CapturedAt
+    default:
+        metadata.Cluster = "offline:" + flags.From
+    }
+
+    lists := make(map[string][]byte)
+    var mu sync.Mutex
+    var tasks []func(ctx context.Context) error
+    for _, resource := range snapshotKinds {
+        resource := resource
+        tasks = append(tasks, func(ctx context.Context) error {
+            var items []json.RawMessage
+            err := source.each(ctx, resource, flags.Namespace, func(item json.RawMessage) error {
+                items = append(items, item)
+                return nil
+            })
+            if err != nil {
+                if isKubeSphereKind(resource) && isNotFound(err) {
+                    return nil // not a KubeSphere cluster
+                }
+                return fmt.Errorf("reading %s: %v", resource, err)
+            }
+            if items == nil {
+                if isKubeSphereKind(resource) && source.client == nil {
+                    return nil
+                }
+                items = []json.RawMessage{}
+            }
+            kind := rbacKinds[resource]
+            list, err := json.MarshalIndent(map[string]interface{}{
+                "apiVersion": strings.TrimPrefix(strings.TrimPrefix(kind.GroupVersionPath, "/apis/"), "/api/"),
+                "kind":       kind.Kind + "List",
+                "items":      items,
+            }, "", "  ")
+            if err != nil {
+                return err
+            }
+            mu.Lock()
+            lists[resource] = list
+            metadata.Kinds[resource] = len(items)
+            mu.Unlock()
+            return nil
+        })
+    }
+    if err := runConcurrently(ctx, tasks); err != nil {
+        return err
+    }
+
+    // discovery data lets --expand and 'show core' work on the snapshot later
+    var encodedDiscovery []byte
+    if source.client != nil || source.discovery != nil {
+        discovery, err := apiResources(ctx, source)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Warning: cannot read API discovery data:", err)
+        } else if encodedDiscovery, err = json.MarshalIndent(discovery, "", "  "); err != nil {
+            return err
+        }
+    }
+
+    encodedMetadata, err := json.MarshalIndent(metadata, "", "  ")
+    if err != nil {
+        return err
+    }
+
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    gz := gzip.NewWriter(file)
+    archive := tar.NewWriter(gz)
+    modTime := time.Now()
+
+    writeEntry := func(name string, data []byte) error {
+        header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime}
+        if err := archive.WriteHeader(header); err != nil {
+            return err
+        }
+        _, err := archive.Write(data)
+        return err
+    }
+    if err := writeEntry("metadata.json", encodedMetadata); err != nil {
+        return err
+    }
+    for _, resource := range snapshotKinds {
+        if list, ok := lists[resource]; ok {
+            if err := writeEntry(resource+".json", list); err != nil {
+                return err
+            }
+        }
+    }
+    if encodedDiscovery != nil {
+        if err := writeEntry("discovery.json", encodedDiscovery); err != nil {
+            return err
+        }
+    }
+    if err := archive.Close(); err != nil {
+        return err
+    }
+    if err := gz.Close(); err != nil {
+        return err
+    }
+    return file.Close()
+}
+
+// reads a snapshot archive written by saveSnapshot
+// also returns the API discovery data stored in the archive, nil for snapshots taken without it
+func loadSnapshot(path string) (map[string][]json.RawMessage, *snapshotMetadata, []APIResourceList, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, nil, nil, err
+    }
+    defer file.Close()
+    gz, err := gzip.NewReader(file)
+    if err != nil {
+        return nil, nil, nil, fmt.Errorf("%s is not a snapshot archive: %v", path, err)
+    }
+    archive := tar.NewReader(gz)
+
+    objects := make(map[string][]json.RawMessage)
+    var metadata *snapshotMetadata
+    var discovery []APIResourceList
+    for {
+        header, err := archive.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, nil, nil, err
+        }
+        data, err := io.ReadAll(archive)
+        if err != nil {
+            return nil, nil, nil, err
+        }
+        switch header.Name {
+        case "metadata.json":
+            metadata = &snapshotMetadata{}
+            if err := json.Unmarshal(data, metadata); err != nil {
+                return nil, nil, nil, fmt.Errorf("invalid snapshot metadata: %v", err)
+            }
+            continue
+        case "discovery.json":
+            if err := json.Unmarshal(data, &discovery); err != nil {
+                return nil, nil, nil, fmt.Errorf("invalid discovery data: %v", err)
+            }
+            continue
+        }
+        if err := addManifests(objects, data); err != nil {
+            return nil, nil, nil, fmt.Errorf("%s: %v", header.Name, err)
+        }
+    }
+    if metadata == nil {
+        return nil, nil, nil, fmt.Errorf("%s has no metadata.json; it is not a snapshot archive", path)
+    }
+    if metadata.SnapshotVersion > snapshotFormatVersion {
+        return nil, nil, nil, fmt.Errorf("snapshot format version %d is newer than this tool supports (%d)", metadata.SnapshotVersion, snapshotFormatVersion)
+    }
+    return objects, metadata, discovery, nil
+}
+
+func displaySnapshotInfo(metadata *snapshotMetadata) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+    fmt.Fprintf(w, "Cluster\t%s\n", metadata.Cluster)
+    fmt.Fprintf(w, "Context\t%s\n", metadata.Context)
+    fmt.Fprintf(w, "Server\t%s\n", metadata.Server)
+    fmt.Fprintf(w, "Server Version\t%s\n", metadata.ServerVersion)
+    fmt.Fprintf(w, "Captured At\t%s\n", metadata.CapturedAt)
+    fmt.Fprintf(w, "Tool Version\t%s\n", metadata.ToolVersion)
+    fmt.Fprintf(w, "Snapshot Format\t%d\n", metadata.SnapshotVersion)
+    if metadata.Namespace != "" {
+        fmt.Fprintf(w, "Namespace\t%s\n", metadata.Namespace)
+    }
+    for _, resource := range snapshotKinds {
+        if count, ok := metadata.Kinds[resource]; ok {
+            fmt.Fprintf(w, "%s\t%d\n", resource, count)
+        }
+    }
+    w.Flush()
+}
+
+
+// ---------------------------------------------------------------------------------------
+// Multi-cluster mode (--contexts a,b,c or --all-contexts)
+// The same command runs against several kubeconfig contexts at once; tables and CSV files get a leading Cluster column.
+// ---------------------------------------------------------------------------------------
+
+type clusterData struct {
+    Name string // kubeconfig context; "" in single-cluster mode
+    Data *rbacData
+}
+
+func isMultiCluster(flags InputFlags) bool {
+    return flags.AllContexts || len(flags.Contexts) > 0
+}
+
+// the leading Cluster cell of a table row in multi-cluster mode, "" otherwise
+func clusterCell(flags InputFlags, cluster string) string {
+    if !isMultiCluster(flags) {
+        return ""
+    }
+    return cluster + "\t"
+}
+
+// the contexts given with --contexts, or every context of the kubeconfig with --all-contexts
+func selectedContexts(flags InputFlags) ([]string, error) {
+    if !flags.AllContexts {
+        return flags.Contexts, nil
+    }
+    config, err := loadKubeConfig(flags.Kubeconfig)
+    if err != nil {
+        return nil, err
+    }
+    var names []string
+    for _, context := range config.Contexts {
+        names = append(names, context.Name)
+    }
+    sort.Strings(names)
+    if len(names) == 0 {
+        return nil, fmt.Errorf("the kubeconfig has no contexts")
+    }
+    return names, nil
+}
+
+// fetches the command's kinds from every selected cluster concurrently. A cluster that cannot be
+// read is reported on stderr and left out, so one unreachable cluster doesn't hide all the others.
+// Fetches the kinds the command needs from one source and applies --expand, the same way for a single cluster and
+// for each cluster of --contexts.
+func fetchClusterData(ctx context.Context, source *rbacSource, flags InputFlags) (*rbacData, error) {
+    data, err := fetchRBACData(ctx, source, requiredKinds(flags), nil, flags.Namespace)
+    if err != nil {
+        return nil, err
+    }
+    // the risk catalog needs the wildcards as they are
+    if flags.Expand && !flags.Overpowered {
+        if err := expandRBACData(ctx, source, data); err != nil {
+            return nil, fmt.Errorf("expanding wildcards: %w", err)
+        }
+    }
+    return data, nil
+}
+
+func fetchClusters(ctx context.Context, flags InputFlags) ([]clusterData, error) {
+    names, err := selectedContexts(flags)
+    if err != nil {
+        return nil, err
+    }
+
+    results := make([]*rbacData, len(names))
+    var tasks []func(ctx context.Context) error
+    for i, name := range names {
+        i, name := i, name
+        tasks = append(tasks, func(ctx context.Context) error {
+            contextFlags := flags
+            contextFlags.Context = name
+            source, err := newRBACSource(contextFlags)
+            var data *rbacData
+            if err == nil {
+                data, err = fetchClusterData(ctx, source, flags)
+            }
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Warning: skipping cluster %s: %v\n", name, err)
+                return nil
+            }
+            results[i] = data
+            return nil
+        })
+    }
+    if err := runConcurrently(ctx, tasks); err != nil {
+        return nil, err
+    }
+
+    var clusters []clusterData
+    for i, name := range names {
+        if results[i] != nil {
+            clusters = append(clusters, clusterData{Name: name, Data: results[i]})
+        }
+    }
+    if len(clusters) == 0 {
+        return nil, fmt.Errorf("none of the selected clusters could be read")
+    }
+    return clusters, nil
+}
+
+// concatenates the data of all clusters, marking every object with its cluster
+func mergeClusterData(clusters []clusterData) *rbacData {
+    if len(clusters) == 1 && clusters[0].Name == "" {
+        return clusters[0].Data
+    }
+    merged := &rbacData{}
+    markRoles := func(cluster string, roles []Role) []Role {
+        var marked []Role
+        for _, role := range roles {
+            role.Cluster = cluster
+            marked = append(marked, role)
+        }
+        return marked
+    }
+    markBindings := func(cluster string, bindings []RoleBinding) []RoleBinding {
+        var marked []RoleBinding
+        for _, binding := range bindings {
+            binding.Cluster = cluster
+            marked = append(marked, binding)
+        }
+        return marked
+    }
+    for _, cluster := range clusters {
+        data := cluster.Data
+        merged.Roles = append(merged.Roles, markRoles(cluster.Name, data.Roles)...)
+        merged.ClusterRoles = append(merged.ClusterRoles, markRoles(cluster.Name, data.ClusterRoles)...)
+        merged.WorkspaceRoles = append(merged.WorkspaceRoles, markRoles(cluster.Name, data.WorkspaceRoles)...)
+        merged.GlobalRoles = append(merged.GlobalRoles, markRoles(cluster.Name, data.GlobalRoles)...)
+        merged.RoleBindings = append(merged.RoleBindings, markBindings(cluster.Name, data.RoleBindings)...)
+        merged.ClusterRoleBindings = append(merged.ClusterRoleBindings, markBindings(cluster.Name, data.ClusterRoleBindings)...)
+        merged.WorkspaceRoleBindings = append(merged.WorkspaceRoleBindings, markBindings(cluster.Name, data.WorkspaceRoleBindings)...)
+        merged.GlobalRoleBindings = append(merged.GlobalRoleBindings, markBindings(cluster.Name, data.GlobalRoleBindings)...)
+    }
+    return merged
+}
+
+// builds the user list of 'get user' for every cluster. Accounts are never merged across clusters.
+func buildUserList(clusters []clusterData, flags InputFlags) ([]AccountInfo, error) {
+    var accounts []AccountInfo
+    for _, cluster := range clusters {
+        data := cluster.Data
+        var bindingResults []AccountInfo
+        var err error
+        if flags.KubeSphere {
+            bindingResults, err = processKubeSphereBindings(data.ClusterRoles, data.Roles, data.WorkspaceRoles, data.GlobalRoles, data.ClusterRoleBindings, data.RoleBindings, data.WorkspaceRoleBindings, data.GlobalRoleBindings, flags)
+            if err != nil {
+                return nil, fmt.Errorf("processing KubeSphere bindings: %v", err)
+            }
+            if flags.MoreOption {
+                bindingResults = attachKubeSphereExtra(bindingResults, data.ClusterRoles, data.Roles, data.WorkspaceRoles, data.GlobalRoles)
+            }
+        } else {
+            bindingResults, err = processBindings(data.ClusterRoles, data.Roles, data.ClusterRoleBindings, data.RoleBindings, flags)
+            if err != nil {
+                return nil, fmt.Errorf("processing bindings: %v", err)
+            }
+            if flags.MoreOption {
+                bindingResults = attachExtra(bindingResults, data.ClusterRoles, data.Roles)
+            }
+        }
+        for _, account := range bindingResults {
+            account.Cluster = cluster.Name
+            accounts = append(accounts, account)
+        }
+    }
+    return accounts, nil
+}
+
+
+// ---------------------------------------------------------------------------------------
+// Group membership (--group-members): expands Group subjects into their users
+// Accepted files: YAML or JSON ("group: [user, ...]"), CSV ("group,user[,user...]" per row) and LDIF directory exports.
+// ---------------------------------------------------------------------------------------
+
+func loadGroupMembers(path string) (map[string][]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    members := make(map[string][]string)
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".csv":
+        reader := csv.NewReader(strings.NewReader(string(data)))
+        reader.FieldsPerRecord = -1 // a group has as many fields as it has users
+        reader.TrimLeadingSpace = true
+        records, err := reader.ReadAll()
+        if err != nil {
+            return nil, err
+        }
+        for i, record := range records {
+            group := strings.TrimSpace(record[0])
+            if group == "" {
+                continue
+            }
+            if i == 0 && strings.EqualFold(group, "group") {
+                continue // header
+            }
+            for _, member := range record[1:] {
+                if member = strings.TrimSpace(member); member != "" {
+                    members[group] = append(members[group], member)
+                }
+            }
+        }
+    case ".ldif":
+        members, err = parseLDIFGroups(string(data))
+        if err != nil {
+            return nil, err
+        }
+    default:
+        if err := decodeYAML(data, &members); err != nil {
+            return nil, fmt.Errorf("%s: expected a mapping of group names to lists of users: %v", path, err)
+        }
+    }
+
+    for group, list := range members {
+        sort.Strings(list)
+        var unique []string
+        for i, member := range list {
+            if i == 0 || member != list[i-1] {
+                unique = append(unique, member)
+            }
+        }
+        members[group] = unique
+    }
+    return members, nil
+}
+
+// Reads the groups of an LDIF export. A group is an entry with a cn and member, uniqueMember or memberUid values;
+// members given as DNs ("uid=alice,ou=people,...") are reduced to the value of their first RDN.
+func parseLDIFGroups(data string) (map[string][]string, error) {
+    members := make(map[string][]string)
+    var cn string
+    var entryMembers []string
+    flush := func() {
+        if cn != "" && len(entryMembers) > 0 {
+            members[cn] = append(members[cn], entryMembers...)
+        }
+        cn, entryMembers = "", nil
+    }
+
+    // continuation lines start with a single space
+    var lines []string
+    for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+        if strings.HasPrefix(line, " ") && len(lines) > 0 {
+            lines[len(lines)-1] += line[1:]
+            continue
+        }
+        lines = append(lines, line)
+    }
+
+    for _, line := range lines {
+        if strings.TrimSpace(line) == "" {
+            flush()
+            continue
+        }
+        if strings.HasPrefix(line, "#") {
+            continue
+        }
+        colon := strings.Index(line, ":")
+        if colon < 0 {
+            continue
+        }
+        attribute, value := strings.ToLower(line[:colon]), line[colon+1:]
+        if strings.HasPrefix(value, ":") { // "attr:: <base64>"
+            decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+            if err != nil {
+                return nil, fmt.Errorf("invalid base64 value of %s: %v", attribute, err)
+            }
+            value = string(decoded)
+        }
+        value = strings.TrimSpace(value)
+        switch attribute {
+        case "cn":
+            if cn == "" {
+                cn = value
+            }
+        case "memberuid":
+            entryMembers = append(entryMembers, value)
+        case "member", "uniquemember":
+            rdn := strings.SplitN(value, ",", 2)[0]
+            if eq := strings.Index(rdn, "="); eq >= 0 {
+                rdn = rdn[eq+1:]
+            }
+            entryMembers = append(entryMembers, rdn)
+        }
+    }
+    flush()
+    return members, nil
+}
+
+// adds a binding subject to USERLIST: Users always, ServiceAccounts with --service and Groups with --groups.
+// With --group-members, every member of a Group gets the binding as a User, marked with the group it came from.
+func addSubject(subject BindingSubject, info BindingInfo, flags InputFlags) {
+    switch {
+    case subject.Kind == "User":
+    case subject.Kind == "ServiceAccount" && flags.Service:
+        // a ServiceAccount subject without a namespace lives in the RoleBinding's namespace
+        namespace := subject.Namespace
+        if namespace == "" {
+            namespace = info.Namespace
+        }
+        addToTable(subject.Name, subject.Kind, namespace, info)
+        return
+    case subject.Kind == "Group":
+        GROUPBINDINGS[subject.Name] = append(GROUPBINDINGS[subject.Name], info)
+        for _, member := range GROUPMEMBERS[subject.Name] {
+            memberInfo := info
+            memberInfo.ViaGroup = subject.Name
+            addToTable(member, "User", "", memberInfo)
+        }
+        if !flags.Groups {
+            return
+        }
+    default:
+        return
+    }
+    addToTable(subject.Name, subject.Kind, "", info)
+}
+
+// The groups Kubernetes puts an identity in without any binding saying so: every authenticated identity is in
+// system:authenticated, every ServiceAccount also in system:serviceaccounts and system:serviceaccounts:<namespace>.
+// Anonymous requests (User system:anonymous) are in system:unauthenticated instead.
+func implicitGroups(kind string, name string, namespace string) []string {
+    switch kind {
+    case "User":
+        if name == "system:anonymous" {
+            return []string{"system:unauthenticated"}
+        }
+        return []string{"system:authenticated"}
+    case "ServiceAccount":
+        return []string{"system:authenticated", "system:serviceaccounts", "system:serviceaccounts:" + namespace}
+    }
+    return nil
+}
+
+// Gives every ServiceAccount the bindings of its implicit groups, and Users with --implicit: a binding to
+// system:authenticated would otherwise repeat on every user's rows. Those bindings are marked Implicit.
+func addImplicitGroups(flags InputFlags) {
+    for i, account := range USERLIST {
+        if account.Type == "User" && !flags.Implicit {
+            continue
+        }
+        for _, group := range implicitGroups(account.Type, account.Name, account.Namespace) {
+            for _, info := range GROUPBINDINGS[group] {
+                info.ViaGroup = group
+                info.Implicit = true
+                USERLIST[i].Bindings = append(USERLIST[i].Bindings, info)
+            }
+        }
+    }
+}
+
+// the Kind cell of a binding, naming the group an inherited binding came from
+func bindingKindCell(binding BindingInfo) string {
+    if binding.Implicit {
+        return fmt.Sprintf("%s (implicit group: %s)", binding.Kind, binding.ViaGroup)
+    }
+    if binding.ViaGroup != "" {
+        return fmt.Sprintf("%s (group: %s)", binding.Kind, binding.ViaGroup)
+    }
+    return binding.Kind
+}
+
+
+// function for drawing a table and displaying typical Roles
+func displayRoles(roles []Role, flags InputFlags, systemPrefixes []string) {
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+    fmt.Fprintln(w, clusterCell(flags, "Cluster")+"Namespace\tKind\tRole Name\tapiGroups\tResources\tVerbs")
+    fmt.Fprintln(w, clusterCell(flags, "-------")+"---------\t----\t---------\t---------\t---------\t-----")
+    for _, role := range roles {
+        if flags.ExcludeSystem && isSystemPrefix(role.Metadata.Name, systemPrefixes) {
+            continue
+        }
+        displayedHeader := false
+        for _, rule := range role.Rules {
+            for cellIndex, cell := range ruleCells(rule) {
+                apiGroup, resource := cell[0], cell[1]
+                if cellIndex == 0 && !displayedHeader {
+			// if it's a Workspace(a Concept from Kubesphere), do this, because the 'workspace' is not described in Metadata.Namespace
+			workspaceName, exists := role.Metadata.Labels["kubesphere.io/workspace"]
+			if exists {
+	                        fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t [%s]\n", clusterCell(flags, role.Cluster), workspaceName, role.Kind, role.Metadata.Name, apiGroup, resource, verbsCell(rule.Verbs))
+        	                displayedHeader = true
+			    } else {
+	                        fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t [%s]\n", clusterCell(flags, role.Cluster), role.Metadata.Namespace, role.Kind, role.Metadata.Name, apiGroup, resource, verbsCell(rule.Verbs))
+        	                displayedHeader = true
+			    }
+                } else if cellIndex == 0 { // 첫 번째 cell이지만 header는 아닐 경우
+                    fmt.Fprintf(w, "%s\t\t\t%s\t%s\t [%s]\n", clusterCell(flags, ""), apiGroup, resource, verbsCell(rule.Verbs))
+                } else { // 첫 번째 cell이 아닐 경우
+                    fmt.Fprintf(w, "%s\t\t\t%s\t%s\t\n", clusterCell(flags, ""), apiGroup, resource)
+                }
+            }
+        }
+        
+        if displayedHeader {
+            fmt.Fprintln(w, clusterCell(flags, "-------")+"---------\t----\t---------\t---------\t---------\t-----")
+        }
+    }
+    w.Flush()    
+}
+
+// function for drawing a table and displaying Cluster Roles
+func displayClusterRoles(roles []Role, flags InputFlags, systemPrefixes []string) {
+    
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	fmt.Fprintln(w, clusterCell(flags, "Cluster")+"Kind\tRole Name\tapiGroups\tResources\tVerbs")
+	fmt.Fprintln(w, clusterCell(flags, "-------")+"----\t---------\t---------\t---------\t-----")
+
+	for _, role := range roles {
+		if flags.ExcludeSystem && isSystemPrefix(role.Metadata.Name, systemPrefixes) {
+			continue
+		}
+		displayedHeader := false
+		for _, rule := range role.Rules {
+			for _, cell := range ruleCells(rule) {
+				if !displayedHeader {
+					fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t [%s]\n", clusterCell(flags, role.Cluster), role.Kind, role.Metadata.Name, cell[0], cell[1], verbsCell(rule.Verbs))
+					displayedHeader = true
+				} else {
+					fmt.Fprintf(w, "%s\t\t%s\t%s\t [%s]\n", clusterCell(flags, ""), cell[0], cell[1], verbsCell(rule.Verbs))
+				}
+			}
+		}
+		// list the ClusterRoles an aggregated ClusterRole collects its rules from
+		if len(role.AggregatedFrom) > 0 {
+			if !displayedHeader {
+				fmt.Fprintf(w, "%s%s\t%s\t\t\t\n", clusterCell(flags, role.Cluster), role.Kind, role.Metadata.Name)
+				displayedHeader = true
+			}
+			fmt.Fprintf(w, "%s\t  aggregated from:\t\t\t\n", clusterCell(flags, ""))
+			for _, name := range role.AggregatedFrom {
+				fmt.Fprintf(w, "%s\t  - %s\t\t\t\n", clusterCell(flags, ""), name)
+			}
+		}
+		if displayedHeader {
+			fmt.Fprintln(w, clusterCell(flags, "-------")+"----\t---------\t----------\t---------\t-----")
+		}
+	}
+	w.Flush()
+}
+
+
+func displayClusterRoleBindings(bindings []RoleBinding, flags InputFlags, systemPrefixes []string) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+
+    header := clusterCell(flags, "Cluster") + "Binding Name\tRole Kind\tLink to (Role Name)\tSubject Kind\tSubject Name\tAllows to (namespace)"
+    if flags.ExtendedOption {
+        header += "\tOwnerReferences (apiVersion, kind, name)"
+    }
+    fmt.Fprintln(w, header)
+
+    separator := clusterCell(flags, "-------") + "------------\t---------\t-------\t------------\t------------\t---------"
+    if flags.ExtendedOption {
+        separator += "\t---------"
+    }
+    fmt.Fprintln(w, separator)
+
+    for _, binding := range bindings {
+        if flags.ExcludeSystem && isSystemPrefix(binding.Metadata.Name, systemPrefixes) {
+            continue
+        }
+
+        if len(binding.Subjects) > 0 {
+            namespace := "*"
             if binding.Subjects[0].Kind == "ServiceAccount" {
                 namespace = binding.Subjects[0].Namespace
             }
 
-            orStrings := []string{}
-            for i, or := range binding.Metadata.OwnerReferences {
-                if i == 0 {
-                    orStrings = append(orStrings, fmt.Sprintf("%s,", or.APIVersion))
-                    orStrings = append(orStrings, fmt.Sprintf("\t\t\t\t\t\t%s,", or.Kind))
-                    orStrings = append(orStrings, fmt.Sprintf("\t\t\t\t\t\t%s", or.Name))
-                } else {
-                    orStrings = append(orStrings, fmt.Sprintf("%s,", or.APIVersion))
-                    orStrings = append(orStrings, fmt.Sprintf("%s,", or.Kind))
-                    orStrings = append(orStrings, fmt.Sprintf("%s", or.Name))
+            orStrings := []string{}
+            for i, or := range binding.Metadata.OwnerReferences {
+                if i == 0 {
+                    orStrings = append(orStrings, fmt.Sprintf("%s,", or.APIVersion))
+                    orStrings = append(orStrings, fmt.Sprintf("\t\t\t\t\t\t%s,", or.Kind))
+                    orStrings = append(orStrings, fmt.Sprintf("\t\t\t\t\t\t%s", or.Name))
+                } else {
+                    orStrings = append(orStrings, fmt.Sprintf("%s,", or.APIVersion))
+                    orStrings = append(orStrings, fmt.Sprintf("%s,", or.Kind))
+                    orStrings = append(orStrings, fmt.Sprintf("%s", or.Name))
+                }
+            }
+
+            if len(orStrings) == 0 {
+                orStrings = append(orStrings, "-")
+            }
+
+            if flags.ExtendedOption {
+                // Print first OwnerReference with other details
+                fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\t%s\n", clusterCell(flags, binding.Cluster), binding.Metadata.Name, binding.RoleRef.Kind, binding.RoleRef.Name, binding.Subjects[0].Kind, binding.Subjects[0].Name, namespace, orStrings[0])
+                // Print remaining OwnerReferences
+                for _, orString := range orStrings[1:] {
+                    fmt.Fprintf(w, "%s%s\n", clusterCell(flags, ""), orString)
+                }
+            } else {
+                // Just print without OwnerReferences
+                fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\n", clusterCell(flags, binding.Cluster), binding.Metadata.Name, binding.RoleRef.Kind, binding.RoleRef.Name, binding.Subjects[0].Kind, binding.Subjects[0].Name, namespace)
+            }
+            fmt.Fprintln(w, separator)
+        }
+    }
+    w.Flush()
+}
+
+
+
+func displayRoleBindings(bindings []RoleBinding, flags InputFlags, systemPrefixes []string) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+    fmt.Fprintln(w, clusterCell(flags, "Cluster")+"Kind\tBinding Name\tAllows to (namespace)\tRole Kind\tLink to (Role Name)\tSubject Kind\tSubject Name\tSubject Namespace")
+    fmt.Fprintln(w, clusterCell(flags, "-------")+"----\t------------\t---------\t---------\t-------\t------------\t------------\t-----------------")
+
+    for _, binding := range bindings {
+        if flags.ExcludeSystem && isSystemPrefix(binding.Metadata.Name, systemPrefixes) {
+            continue
+        }
+        displayedHeader := false
+        for index, subject := range binding.Subjects {
+            namespace := subject.Namespace
+            if namespace == "" {
+                namespace = "-"
+            }
+
+            if !displayedHeader {
+		// if it's a Workspace(a Concept from Kubesphere) do this. because the "workspace" is not describe in Metadata.Namespace
+		workspaceName, exists := binding.Metadata.Labels["kubesphere.io/workspace"]
+		if exists {
+		    fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", clusterCell(flags, binding.Cluster), binding.Kind, binding.Metadata.Name, workspaceName, binding.RoleRef.Kind, binding.RoleRef.Name, subject.Kind, subject.Name, namespace)
+		} else {
+		    fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", clusterCell(flags, binding.Cluster), binding.Kind, binding.Metadata.Name, binding.Metadata.Namespace, binding.RoleRef.Kind, binding.RoleRef.Name, subject.Kind, subject.Name, namespace)
+		}
+
+                    displayedHeader = true
+                } else {
+		    fmt.Fprintf(w, "%s\t\t\t\t\t%s\t%s\t%s\n", clusterCell(flags, ""), subject.Kind, subject.Name, namespace)
+                }
+
+            // Only print the separator line after the last subject of a binding
+            if index == len(binding.Subjects) - 1 {
+                fmt.Fprintln(w, clusterCell(flags, "-------")+"----\t------------\t---------\t---------\t-------\t------------\t------------\t-----------------")
+            }
+        }
+    }
+    w.Flush()
+}
+
+
+// user list table create & sort, merge
+
+func processBindings(clusterRoles []Role, roles []Role, clusterRoleBindings []RoleBinding, roleBindings []RoleBinding, flags InputFlags) ([]AccountInfo, error) {
+    // 초기화: USERLIST
+    USERLIST = []AccountInfo{}
+    GROUPBINDINGS = make(map[string][]BindingInfo)
+    containsRoleBinding := false
+    containsClusterRoleBinding := false
+    
+    for _, option:= range flags.OnlyOption {
+	if option == "rolebinding" {
+	    containsRoleBinding = true
+	} else if option == "clusterrolebinding" {
+	    containsClusterRoleBinding = true
+	}
+    }
+
+	
+
+    // ClusterRoleBinding 데이터 처리
+    // if flags.OnlyOption == "" || flags.OnlyOption == "clusterrolebinding" {
+    if len(flags.OnlyOption) == 0 || containsClusterRoleBinding {
+	for _, clusterBinding := range clusterRoleBindings {
+            for _, subject := range clusterBinding.Subjects {
+//	    if subject.Kind == "User" && (!excludeSystem || !strings.HasPrefix(subject.Name, "system:")){
+//	    if subject.Kind == "User" && !strings.HasPrefix(subject.Name, "system:"){
+                info := BindingInfo{
+                    Kind:        clusterBinding.Kind,
+                    RoleRefName: clusterBinding.RoleRef.Name,
+                    RoleRefKind: clusterBinding.RoleRef.Kind,
+                    Default:     clusterBinding.Metadata.Labels[bootstrapLabel] == "rbac-defaults",
+                }
+                addSubject(subject, info, flags)
+            }
+        }
+    }
+
+    // RoleBinding 데이터 처리
+    //if flags.OnlyOption == "" || flags.OnlyOption == "rolebinding" {
+    if len(flags.OnlyOption) == 0 || containsRoleBinding {
+        for _, roleBinding := range roleBindings {
+            for _, subject := range roleBinding.Subjects {
+//	    if subject.Kind == "User" && (!excludeSystem || !strings.HasPrefix(subject.Name, "system:")){
+//	    if subject.Kind == "User" && !strings.HasPrefix(subject.Name, "system:"){
+                info := BindingInfo{
+                    Kind:        roleBinding.Kind,
+                    Namespace:   roleBinding.Metadata.Namespace,
+                    RoleRefName: roleBinding.RoleRef.Name,
+                    RoleRefKind: roleBinding.RoleRef.Kind,
+                    Default:     roleBinding.Metadata.Labels[bootstrapLabel] == "rbac-defaults",
+                }
+                addSubject(subject, info, flags)
+            }
+        }
+    }
+
+    addImplicitGroups(flags)
+    sortTable()
+    mergeAccounts()
+
+    // return VALUES that processed USERLIST
+    return USERLIST, nil
+}
+
+func processKubeSphereBindings(clusterRoles []Role, roles []Role, workspaceRoles []Role, globalRoles []Role, clusterRoleBindings []RoleBinding, roleBindings []RoleBinding, workspaceRoleBindings []RoleBinding, globalRoleBindings []RoleBinding, flags InputFlags) ([]AccountInfo, error) {
+    // 초기화: USERLIST
+    USERLIST = []AccountInfo{}
+    GROUPBINDINGS = make(map[string][]BindingInfo)
+    containsRoleBinding := false
+    containsClusterRoleBinding := false
+    containsWorkspaceRoleBinding := false
+    containsGlobalRoleBinding := false
+    
+    for _, option:= range flags.OnlyOption {
+	if option == "rolebinding" {
+	    containsRoleBinding = true
+	} else if option == "clusterrolebinding" {
+	    containsClusterRoleBinding = true 
+	} else if option == "workspacerolebinding" {
+	    containsWorkspaceRoleBinding = true
+	} else if option == "globalrolebinding" {
+	    containsGlobalRoleBinding = true
+	}
+    }
+
+    if len(flags.OnlyOption) == 0 || containsClusterRoleBinding {
+	for _, clusterBinding := range clusterRoleBindings {
+            for _, subject := range clusterBinding.Subjects {
+                info := BindingInfo{
+                    Kind:        clusterBinding.Kind,
+                    RoleRefName: clusterBinding.RoleRef.Name,
+                    RoleRefKind: clusterBinding.RoleRef.Kind,
+                    Default:     clusterBinding.Metadata.Labels[bootstrapLabel] == "rbac-defaults",
+                }
+                addSubject(subject, info, flags)
+            }
+        }
+    }
+
+    if len(flags.OnlyOption) == 0 || containsRoleBinding {
+        for _, roleBinding := range roleBindings {
+            for _, subject := range roleBinding.Subjects {
+                info := BindingInfo{
+                    Kind:        roleBinding.Kind,
+                    Namespace:   roleBinding.Metadata.Namespace,
+                    RoleRefName: roleBinding.RoleRef.Name,
+                    RoleRefKind: roleBinding.RoleRef.Kind,
+                    Default:     roleBinding.Metadata.Labels[bootstrapLabel] == "rbac-defaults",
+                }
+                addSubject(subject, info, flags)
+            }
+        }
+    }
+
+    if containsWorkspaceRoleBinding {
+	for _, workspaceBinding := range workspaceRoleBindings {
+            for _, subject := range workspaceBinding.Subjects {
+                info := BindingInfo{
+                    Kind:        workspaceBinding.Kind,
+                Namespace:   workspaceBinding.Metadata.Labels["kubesphere.io/workspace"],
+                    RoleRefName: workspaceBinding.RoleRef.Name,
+                    RoleRefKind: workspaceBinding.RoleRef.Kind,
+                }
+                addSubject(subject, info, flags)
+            }
+        }
+    }
+
+    if containsGlobalRoleBinding {
+	for _, globalBinding := range globalRoleBindings {
+            for _, subject := range globalBinding.Subjects {
+                info := BindingInfo{
+                    Kind:        globalBinding.Kind,
+                    RoleRefName: globalBinding.RoleRef.Name,
+                    RoleRefKind: globalBinding.RoleRef.Kind,
+                }
+                addSubject(subject, info, flags)
+            }
+        }
+    }
+
+
+    addImplicitGroups(flags)
+    sortTable()
+    mergeAccounts()
+
+    // return VALUES that processed USERLIST
+    return USERLIST, nil
+}
+
+func addToTable(name string, kind string, namespace string, info BindingInfo) {
+    // accounts are identified by kind, namespace and name: "default" ServiceAccounts of two namespaces,
+    // or a Group and a User of the same name, are different accounts
+    for i, account := range USERLIST {
+        if account.Name == name && account.Type == kind && account.Namespace == namespace {
+            USERLIST[i].Bindings = append(account.Bindings, info)
+            return
+        }
+    }
+    USERLIST = append(USERLIST, AccountInfo{Name: name, Type: kind, Namespace: namespace, Bindings: []BindingInfo{info}})
+}
+
+// the name an account is displayed with: "namespace/name" for ServiceAccounts
+func accountName(account AccountInfo) string {
+    if account.Namespace != "" {
+        return account.Namespace + "/" + account.Name
+    }
+    return account.Name
+}
+
+// Sorts the accounts by kind, namespace and name, the key that identifies them (see addToTable), so ServiceAccounts
+// come in the order of their "namespace/name" and equal names of different namespaces keep their order.
+func sortTable() {
+    sort.SliceStable(USERLIST, func(i, j int) bool {
+        if USERLIST[i].Type != USERLIST[j].Type {
+            return USERLIST[i].Type < USERLIST[j].Type
+        }
+        if USERLIST[i].Namespace != USERLIST[j].Namespace {
+            return USERLIST[i].Namespace < USERLIST[j].Namespace
+        }
+        return USERLIST[i].Name < USERLIST[j].Name
+    })
+}
+
+func mergeAccounts() {
+    for i := 0; i < len(USERLIST); i++ {
+        for j := i + 1; j < len(USERLIST); j++ {
+            if USERLIST[i].Name == USERLIST[j].Name && USERLIST[i].Type == USERLIST[j].Type && USERLIST[i].Namespace == USERLIST[j].Namespace {
+                USERLIST[i].Bindings = append(USERLIST[i].Bindings, USERLIST[j].Bindings...)
+                USERLIST = append(USERLIST[:j], USERLIST[j+1:]...)
+                j--
+            }
+        }
+    }
+}
+
+func attachExtra(accounts []AccountInfo, refinedClusterRoles []Role, refinedRoles []Role) []AccountInfo {
+    return attachRoleRules(accounts, map[string][]Role{
+        "ClusterRole": refinedClusterRoles,
+        "Role":        refinedRoles,
+    })
+}
+func attachKubeSphereExtra(accounts []AccountInfo, refinedClusterRoles []Role, refinedRoles []Role, refinedWorkspaceRoles []Role, refinedGlobalRoles []Role) []AccountInfo {
+    return attachRoleRules(accounts, map[string][]Role{
+        "ClusterRole":   refinedClusterRoles,
+        "Role":          refinedRoles,
+        "WorkspaceRole": refinedWorkspaceRoles,
+        "GlobalRole":    refinedGlobalRoles,
+    })
+}
+
+// The API server ignores nonResourceURLs in roles bound by a RoleBinding, since URLs don't belong to a namespace.
+func withoutNonResourceRules(rules []RoleRule) []RoleRule {
+    var kept []RoleRule
+    for _, rule := range rules {
+        if len(rule.NonResourceURLs) > 0 {
+            rule.NonResourceURLs = nil
+            if len(rule.Resources) == 0 {
+                continue
+            }
+        }
+        kept = append(kept, rule)
+    }
+    return kept
+}
+
+// Attaches the rules of the role each binding refers to. A Role is looked up in the binding's namespace, since
+// Roles of the same name in other namespaces are unrelated; all other kinds are cluster-scoped and looked up by name.
+// A binding whose role doesn't exist is marked Unresolved rather than shown without rules.
+func attachRoleRules(accounts []AccountInfo, rolesByKind map[string][]Role) []AccountInfo {
+    for i, account := range accounts {
+        for j, binding := range account.Bindings {
+            found := false
+            for _, role := range rolesByKind[binding.RoleRefKind] {
+                if role.Metadata.Name != binding.RoleRefName {
+                    continue
+                }
+                if binding.RoleRefKind == "Role" && role.Metadata.Namespace != binding.Namespace {
+                    continue
+                }
+                rules := role.Rules
+                if binding.Namespace != "" {
+                    rules = withoutNonResourceRules(rules)
+                }
+                accounts[i].Bindings[j].ExtraRules = append(binding.ExtraRules, rules...)
+                found = true
+                break
+            }
+            accounts[i].Bindings[j].Unresolved = !found
+        }
+    }
+    return accounts
+}
+
+
+
+func displayProcessedTable(accounts []AccountInfo, flags InputFlags) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+
+    if flags.MoreOption {
+        fmt.Fprintln(w, clusterCell(flags, "Cluster")+"Account Name\tID Type\tKind\tNamespace\tRoleRefName\tRoleRefKind\tapiGroups\tResources\tVerbs")
+        fmt.Fprintln(w, clusterCell(flags, "-------")+"------------\t-------\t----\t---------\t-----------\t-----------\t---------\t---------\t-----")
+    } else {
+        fmt.Fprintln(w, clusterCell(flags, "Cluster")+"Account Name\tID Type\tKind\tNamespace\tRoleRefName\tRoleRefKind")
+        fmt.Fprintln(w, clusterCell(flags, "-------")+"------------\t-------\t----\t---------\t-----------\t-----------")
+    }
+
+    prevCluster := ""
+    prevAccountName := ""
+    prevAccountType := ""
+    prevAccountNamespace := ""
+    prevRoleRefName := ""
+    prevBindingNamespace := ""
+
+    for _, account := range accounts {
+        displayAccountName := true
+
+        for _, binding := range account.Bindings {
+            if flags.MoreOption && (binding.RoleRefName != prevRoleRefName || binding.Namespace != prevBindingNamespace) && prevRoleRefName != "" {
+                if account.Name == prevAccountName && account.Type == prevAccountType && account.Namespace == prevAccountNamespace && account.Cluster == prevCluster {
+                    fmt.Fprintln(w, clusterCell(flags, "")+"\t\t----\t---------\t-----------\t-----------\t---------\t---------\t-----")
+                } else {
+                    fmt.Fprintln(w, clusterCell(flags, "-------")+"------------\t-------\t----\t---------\t-----------\t-----------\t---------\t---------\t-----")
+                }
+            }
+
+	    // "ServiceAccount" to "Service", for short name
+            var idType string
+            if account.Type == "ServiceAccount" {
+                idType = "Service"
+            } else {
+                idType = account.Type
+            }
+
+            if displayAccountName {
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s", clusterCell(flags, account.Cluster), accountName(account), idType, bindingKindCell(binding), binding.Namespace, binding.RoleRefName, binding.RoleRefKind)
+                displayAccountName = false
+            } else {
+                fmt.Fprintf(w, "%s\t\t%s\t%s\t%s\t%s", clusterCell(flags, ""), bindingKindCell(binding), binding.Namespace, binding.RoleRefName, binding.RoleRefKind)
+            }
+
+            if flags.MoreOption && len(binding.ExtraRules) > 0 {
+                first := true // the first rule goes on the binding's own line
+                for _, rule := range binding.ExtraRules {
+                    for _, cell := range ruleCells(rule) {
+                        if first {
+                            fmt.Fprintf(w, "\t%s\t%s\t[%s]\n", cell[0], cell[1], verbsCell(rule.Verbs))
+                            first = false
+                        } else {
+                            fmt.Fprintf(w, "%s\t\t\t\t\t\t%s\t%s\t[%s]\n", clusterCell(flags, ""), cell[0], cell[1], verbsCell(rule.Verbs))
+                        }
+                    }
+                }
+            } else if flags.MoreOption && binding.Unresolved {
+                fmt.Fprintf(w, "\t\t(roleRef not found)\t\n")
+            } else {
+                fmt.Fprintln(w)
+            }
+
+            prevRoleRefName = binding.RoleRefName // 현재 RoleRefName을 저장
+            prevAccountName = account.Name        // 현재 Account Name을 저장
+            prevAccountType = account.Type
+            prevAccountNamespace = account.Namespace
+            prevCluster = account.Cluster
+            prevBindingNamespace = binding.Namespace // 현재 Namespace를 저장
+        }
+
+        if !flags.MoreOption {
+            fmt.Fprintln(w, clusterCell(flags, "-------")+"------------\t-------\t----\t---------\t-----------\t-----------")
+        }
+    }
+    w.Flush()
+}
+
+
+
+func saveAsCSV(accounts []AccountInfo, flags InputFlags) {
+    var filename string
+
+    if flags.MoreOption {
+        filename = "userListExtended.csv"
+    } else {
+        filename = "userList.csv"
+    }
+
+    file, err := os.Create(filename)
+    if err != nil {
+        log.Fatal("Cannot create file", err)
+    }
+    defer file.Close()
+
+    writer := csv.NewWriter(file)
+    defer writer.Flush()
+
+    // in multi-cluster mode every record starts with the cluster
+    var lead []string
+    if isMultiCluster(flags) {
+        lead = []string{"Cluster"}
+    }
+    if flags.MoreOption {
+        writer.Write(append(lead, "Account Name", "Account Type", "Account Namespace", "Kind", "Namespace", "RoleRefName", "RoleRefKind", "apiGroups", "Resources", "Verbs"))
+    } else {
+        writer.Write(append(lead, "Account Name", "Account Type", "Account Namespace", "Kind", "Namespace", "RoleRefName", "RoleRefKind"))
+    }
+
+    for _, account := range accounts {
+        for _, binding := range account.Bindings {
+            var record []string
+            if isMultiCluster(flags) {
+                record = append(record, account.Cluster)
+            }
+            record = append(record, account.Name, account.Type, account.Namespace, bindingKindCell(binding), binding.Namespace, binding.RoleRefName, binding.RoleRefKind)
+
+            if flags.MoreOption && len(binding.ExtraRules) > 0 {
+                first := true
+                // Handling subsequent rules similar to displayProcessedTable
+                for _, rule := range binding.ExtraRules {
+                    for _, cell := range ruleCells(rule) {
+                        if first {
+                            writer.Write(append(record, cell[0], cell[1], verbsCell(rule.Verbs)))
+                            first = false
+                        } else {
+                            row := append(make([]string, len(lead)), "", "", "", "", "", "", "", cell[0], cell[1], verbsCell(rule.Verbs))
+                            writer.Write(row)
+                        }
+                    }
+                }
+            } else if flags.MoreOption && binding.Unresolved {
+                writer.Write(append(record, "", "(roleRef not found)", ""))
+            } else {
+                writer.Write(record)
+            }
+        }
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// diff: what RBAC changed between two snapshots, or between a snapshot and the live cluster
+// ---------------------------------------------------------------------------------------
+
+// describes where the data of a source came from, for report headers
+func sourceLabel(source *rbacSource, flags InputFlags) string {
+    switch {
+    case source.snapshot != nil:
+        return fmt.Sprintf("snapshot of %s captured at %s", source.snapshot.Cluster, source.snapshot.CapturedAt)
+    case source.client != nil:
+        return fmt.Sprintf("live cluster %s (context %s)", source.client.ClusterName, source.client.ContextName)
+    default:
+        return "files " + flags.From
+    }
+}
+
+// one line per merged rule, used to compare Roles
+func ruleStrings(rules []RoleRule) []string {
+    var lines []string
+    for _, rule := range rules {
+        for _, cell := range ruleCells(rule) {
+            apiGroup := cell[0]
+            if apiGroup == "" {
+                apiGroup = `""`
+            }
+            lines = append(lines, fmt.Sprintf("%s %s [%s]", apiGroup, cell[1], verbsCell(rule.Verbs)))
+        }
+    }
+    sort.Strings(lines)
+    return lines
+}
+
+// one line per subject plus the roleRef, used to compare bindings
+func bindingStrings(binding RoleBinding) []string {
+    lines := []string{fmt.Sprintf("roleRef %s/%s", binding.RoleRef.Kind, binding.RoleRef.Name)}
+    for _, subject := range binding.Subjects {
+        if subject.Namespace != "" {
+            lines = append(lines, fmt.Sprintf("subject %s %s/%s", subject.Kind, subject.Namespace, subject.Name))
+        } else {
+            lines = append(lines, fmt.Sprintf("subject %s %s", subject.Kind, subject.Name))
+        }
+    }
+    sort.Strings(lines)
+    return lines
+}
+
+// returns the lines only in a, and the lines only in b
+func diffLines(a []string, b []string) ([]string, []string) {
+    inA := make(map[string]bool)
+    inB := make(map[string]bool)
+    for _, line := range a {
+        inA[line] = true
+    }
+    for _, line := range b {
+        inB[line] = true
+    }
+    var removed, added []string
+    for _, line := range a {
+        if !inB[line] {
+            removed = append(removed, line)
+        }
+    }
+    for _, line := range b {
+        if !inA[line] {
+            added = append(added, line)
+        }
+    }
+    return removed, added
+}
+
+// an added, removed or modified object
+type objectChange struct {
+    Change    string // "added", "removed" or "modified"
+    Kind      string
+    Namespace string
+    Name      string
+    Details   []string // "+ line" and "- line"
+}
+
+// compares two sets of objects that have been turned into lines, keyed by "namespace/name"
+func diffObjects(kind string, before map[string][]string, after map[string][]string) []objectChange {
+    var changes []objectChange
+    split := func(key string) (string, string) {
+        parts := strings.SplitN(key, "/", 2)
+        return parts[0], parts[1]
+    }
+    for key, lines := range before {
+        namespace, name := split(key)
+        afterLines, ok := after[key]
+        if !ok {
+            changes = append(changes, objectChange{Change: "removed", Kind: kind, Namespace: namespace, Name: name})
+            continue
+        }
+        removed, added := diffLines(lines, afterLines)
+        if len(removed) > 0 || len(added) > 0 {
+            change := objectChange{Change: "modified", Kind: kind, Namespace: namespace, Name: name}
+            for _, line := range added {
+                change.Details = append(change.Details, "+ "+line)
+            }
+            for _, line := range removed {
+                change.Details = append(change.Details, "- "+line)
+            }
+            changes = append(changes, change)
+        }
+    }
+    for key := range after {
+        if _, ok := before[key]; !ok {
+            namespace, name := split(key)
+            changes = append(changes, objectChange{Change: "added", Kind: kind, Namespace: namespace, Name: name})
+        }
+    }
+    return changes
+}
+
+func roleLines(roles []Role) map[string][]string {
+    lines := make(map[string][]string)
+    for _, role := range roles {
+        lines[role.Metadata.Namespace+"/"+role.Metadata.Name] = ruleStrings(role.Rules)
+    }
+    return lines
+}
+
+func bindingLines(bindings []RoleBinding) map[string][]string {
+    lines := make(map[string][]string)
+    for _, binding := range bindings {
+        lines[binding.Metadata.Namespace+"/"+binding.Metadata.Name] = bindingStrings(binding)
+    }
+    return lines
+}
+
+func diffRBACObjects(before *rbacData, after *rbacData) []objectChange {
+    var changes []objectChange
+    changes = append(changes, diffObjects("ClusterRole", roleLines(before.ClusterRoles), roleLines(after.ClusterRoles))...)
+    changes = append(changes, diffObjects("Role", roleLines(before.Roles), roleLines(after.Roles))...)
+    changes = append(changes, diffObjects("ClusterRoleBinding", bindingLines(before.ClusterRoleBindings), bindingLines(after.ClusterRoleBindings))...)
+    changes = append(changes, diffObjects("RoleBinding", bindingLines(before.RoleBindings), bindingLines(after.RoleBindings))...)
+    changes = append(changes, diffObjects("GlobalRole", roleLines(before.GlobalRoles), roleLines(after.GlobalRoles))...)
+    changes = append(changes, diffObjects("WorkspaceRole", roleLines(before.WorkspaceRoles), roleLines(after.WorkspaceRoles))...)
+    changes = append(changes, diffObjects("GlobalRoleBinding", bindingLines(before.GlobalRoleBindings), bindingLines(after.GlobalRoleBindings))...)
+    changes = append(changes, diffObjects("WorkspaceRoleBinding", bindingLines(before.WorkspaceRoleBindings), bindingLines(after.WorkspaceRoleBindings))...)
+
+    kindOrder := map[string]int{"ClusterRole": 0, "Role": 1, "ClusterRoleBinding": 2, "RoleBinding": 3, "GlobalRole": 4, "WorkspaceRole": 5, "GlobalRoleBinding": 6, "WorkspaceRoleBinding": 7}
+    sort.Slice(changes, func(i, j int) bool {
+        if changes[i].Kind != changes[j].Kind {
+            return kindOrder[changes[i].Kind] < kindOrder[changes[j].Kind]
+        }
+        if changes[i].Namespace != changes[j].Namespace {
+            return changes[i].Namespace < changes[j].Namespace
+        }
+        return changes[i].Name < changes[j].Name
+    })
+    return changes
+}
+
+// what one subject may do on one resource in one namespace ("*" for cluster-wide bindings)
+type permissionKey struct {
+    SubjectName string
+    SubjectType string
+    Namespace   string
+    APIGroup    string
+    Resource    string
+}
+
+// a subject's verbs that appeared or disappeared on one resource
+type permissionChange struct {
+    permissionKey
+    Gained []string
+    Lost   []string
+}
+
+// flattens processed accounts (with ExtraRules attached) into verb sets per subject, namespace and resource
+func accountPermissions(accounts []AccountInfo) map[permissionKey]map[string]struct{} {
+    permissions := make(map[permissionKey]map[string]struct{})
+    for _, account := range accounts {
+        for _, binding := range account.Bindings {
+            namespace := binding.Namespace
+            if namespace == "" {
+                namespace = "*"
+            }
+            for _, rule := range binding.ExtraRules {
+                for _, cell := range ruleCells(rule) {
+                    key := permissionKey{accountName(account), account.Type, namespace, cell[0], cell[1]}
+                    if permissions[key] == nil {
+                        permissions[key] = make(map[string]struct{})
+                    }
+                    for _, verb := range rule.Verbs {
+                        permissions[key][verb] = struct{}{}
+                    }
+                }
+            }
+        }
+    }
+    return permissions
+}
+
+// Builds the subject-centric model of 'get user --more --service --groups' for one side of the diff. A side with
+// KubeSphere objects gets the model of -ks with every binding kind, so changes to GlobalRoles, WorkspaceRoles and
+// their bindings show up per subject too.
+func effectivePermissions(data *rbacData) map[permissionKey]map[string]struct{} {
+    modelFlags := InputFlags{Service: true, Groups: true, MoreOption: true}
+    var accounts []AccountInfo
+    if len(data.WorkspaceRoles)+len(data.GlobalRoles)+len(data.WorkspaceRoleBindings)+len(data.GlobalRoleBindings) > 0 {
+        modelFlags.KubeSphere = true
+        modelFlags.OnlyOption = []string{"clusterrolebinding", "rolebinding", "workspacerolebinding", "globalrolebinding"}
+        accounts, _ = processKubeSphereBindings(data.ClusterRoles, data.Roles, data.WorkspaceRoles, data.GlobalRoles, data.ClusterRoleBindings, data.RoleBindings, data.WorkspaceRoleBindings, data.GlobalRoleBindings, modelFlags)
+        accounts = attachKubeSphereExtra(accounts, data.ClusterRoles, data.Roles, data.WorkspaceRoles, data.GlobalRoles)
+    } else {
+        accounts, _ = processBindings(data.ClusterRoles, data.Roles, data.ClusterRoleBindings, data.RoleBindings, modelFlags)
+        accounts = attachExtra(accounts, data.ClusterRoles, data.Roles)
+    }
+    return accountPermissions(accounts)
+}
+
+func diffPermissions(before *rbacData, after *rbacData) []permissionChange {
+    beforePermissions := effectivePermissions(before)
+    afterPermissions := effectivePermissions(after)
+
+    // verbs not covered by the other side; a "*" covers every verb
+    missing := func(verbs map[string]struct{}, other map[string]struct{}) []string {
+        if _, ok := other["*"]; ok {
+            return nil
+        }
+        var result []string
+        for verb := range verbs {
+            if _, ok := other[verb]; !ok {
+                result = append(result, verb)
+            }
+        }
+        sort.Strings(result)
+        return result
+    }
+
+    keys := make(map[permissionKey]struct{})
+    for key := range beforePermissions {
+        keys[key] = struct{}{}
+    }
+    for key := range afterPermissions {
+        keys[key] = struct{}{}
+    }
+
+    var changes []permissionChange
+    for key := range keys {
+        gained := missing(afterPermissions[key], beforePermissions[key])
+        lost := missing(beforePermissions[key], afterPermissions[key])
+        if len(gained) > 0 || len(lost) > 0 {
+            changes = append(changes, permissionChange{permissionKey: key, Gained: gained, Lost: lost})
+        }
+    }
+    sort.Slice(changes, func(i, j int) bool {
+        a, b := changes[i].permissionKey, changes[j].permissionKey
+        if a.SubjectName != b.SubjectName {
+            return a.SubjectName < b.SubjectName
+        }
+        if a.SubjectType != b.SubjectType {
+            return a.SubjectType < b.SubjectType
+        }
+        if a.Namespace != b.Namespace {
+            return a.Namespace < b.Namespace
+        }
+        if a.APIGroup != b.APIGroup {
+            return a.APIGroup < b.APIGroup
+        }
+        return a.Resource < b.Resource
+    })
+    return changes
+}
+
+func displayDiff(beforeLabel string, afterLabel string, objectChanges []objectChange, permissionChanges []permissionChange) {
+    fmt.Println("# RBAC changes")
+    fmt.Println("#   from:", beforeLabel)
+    fmt.Println("#   to:  ", afterLabel)
+    fmt.Println()
+
+    if len(objectChanges) == 0 {
+        fmt.Println("No Roles, ClusterRoles or bindings changed.")
+    } else {
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+        fmt.Fprintln(w, "Change\tKind\tNamespace\tName\tDetails")
+        fmt.Fprintln(w, "------\t----\t---------\t----\t-------")
+        for _, change := range objectChanges {
+            details := []string{""}
+            if len(change.Details) > 0 {
+                details = change.Details
+            }
+            fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", change.Change, change.Kind, change.Namespace, change.Name, details[0])
+            for _, detail := range details[1:] {
+                fmt.Fprintf(w, "\t\t\t\t%s\n", detail)
+            }
+        }
+        w.Flush()
+    }
+    fmt.Println()
+
+    fmt.Println("# Permission changes per subject")
+    if len(permissionChanges) == 0 {
+        fmt.Println("No subject gained or lost permissions.")
+        return
+    }
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+    fmt.Fprintln(w, "Account Name\tID Type\tNamespace\tapiGroups\tResources\tGained Verbs\tLost Verbs")
+    fmt.Fprintln(w, "------------\t-------\t---------\t---------\t---------\t------------\t----------")
+    prevAccount := ""
+    for _, change := range permissionChanges {
+        name, idType := change.SubjectName, change.SubjectType
+        if change.SubjectName+"\x00"+change.SubjectType == prevAccount {
+            name, idType = "", ""
+        } else if prevAccount != "" {
+            fmt.Fprintln(w, "------------\t-------\t---------\t---------\t---------\t------------\t----------")
+        }
+        prevAccount = change.SubjectName + "\x00" + change.SubjectType
+        gained, lost := "", ""
+        if len(change.Gained) > 0 {
+            gained = "[" + strings.Join(change.Gained, ", ") + "]"
+        }
+        if len(change.Lost) > 0 {
+            lost = "[" + strings.Join(change.Lost, ", ") + "]"
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, idType, change.Namespace, change.APIGroup, change.Resource, gained, lost)
+    }
+    w.Flush()
+}
+
+// compares DiffPaths[0] (a snapshot) with DiffPaths[1], or with the current source (live cluster, --from or --snapshot)
+func runDiff(ctx context.Context, flags InputFlags) error {
+    beforeSource, err := newRBACSource(InputFlags{Snapshot: flags.DiffPaths[0]})
+    if err != nil {
+        return err
+    }
+    var afterSource *rbacSource
+    if len(flags.DiffPaths) > 1 {
+        afterSource, err = newRBACSource(InputFlags{Snapshot: flags.DiffPaths[1]})
+    } else {
+        afterSource, err = newRBACSource(flags)
+    }
+    if err != nil {
+        return err
+    }
+
+    // both sides are read at the same time
+    var before, after *rbacData
+    err = runConcurrently(ctx, []func(ctx context.Context) error{
+        func(ctx context.Context) error {
+            var err error
+            before, err = fetchRBACData(ctx, beforeSource, kubernetesRBACKinds, kubeSphereRBACKinds, flags.Namespace)
+            return err
+        },
+        func(ctx context.Context) error {
+            var err error
+            after, err = fetchRBACData(ctx, afterSource, kubernetesRBACKinds, kubeSphereRBACKinds, flags.Namespace)
+            return err
+        },
+    })
+    if err != nil {
+        return err
+    }
+
+    displayDiff(sourceLabel(beforeSource, flags), sourceLabel(afterSource, flags), diffRBACObjects(before, after), diffPermissions(before, after))
+    return nil
+}
+
+
+// ---------------------------------------------------------------------------------------
+// get orphans: cross-references roles, bindings and service accounts for cleanup work
+// ---------------------------------------------------------------------------------------
+
+type orphan struct {
+    Problem   string // "dangling roleRef", "unreferenced role" or "missing subject"
+    Kind      string
+    Namespace string
+    Name      string
+    Detail    string
+}
+
+// Finds bindings whose roleRef points nowhere, roles no binding references and ServiceAccount subjects that don't
+// exist. checkSubjects is false when the source has no ServiceAccounts to compare with (offline files without them).
+func findOrphans(data *rbacData, flags InputFlags, systemPrefixes []string, checkSubjects bool) []orphan {
+    var orphans []orphan
+
+    roleExists := make(map[string]bool) // "Role/<namespace>/<name>" or "ClusterRole/<name>"
+    for _, role := range data.Roles {
+        roleExists["Role/"+role.Metadata.Namespace+"/"+role.Metadata.Name] = true
+    }
+    for _, role := range data.ClusterRoles {
+        roleExists["ClusterRole/"+role.Metadata.Name] = true
+    }
+    namespaceExists := make(map[string]bool)
+    for _, namespace := range data.Namespaces {
+        namespaceExists[namespace.Metadata.Name] = true
+    }
+    serviceAccountExists := make(map[string]bool)
+    for _, account := range data.ServiceAccounts {
+        serviceAccountExists[account.Metadata.Namespace+"/"+account.Metadata.Name] = true
+    }
+
+    referenced := make(map[string]bool)
+    var bindings []RoleBinding
+    bindings = append(bindings, data.ClusterRoleBindings...)
+    bindings = append(bindings, data.RoleBindings...)
+    for _, binding := range bindings {
+        // a RoleBinding may refer to a Role of its own namespace or to a ClusterRole
+        key := "ClusterRole/" + binding.RoleRef.Name
+        target := "ClusterRole " + binding.RoleRef.Name
+        if binding.RoleRef.Kind == "Role" {
+            key = "Role/" + binding.Metadata.Namespace + "/" + binding.RoleRef.Name
+            target = "Role " + binding.Metadata.Namespace + "/" + binding.RoleRef.Name
+        }
+        referenced[key] = true
+        if !roleExists[key] {
+            orphans = append(orphans, orphan{"dangling roleRef", binding.Kind, binding.Metadata.Namespace, binding.Metadata.Name, target + " does not exist"})
+        }
+
+        if !checkSubjects {
+            continue
+        }
+        for _, subject := range binding.Subjects {
+            if subject.Kind != "ServiceAccount" {
+                continue
+            }
+            namespace := subject.Namespace
+            if namespace == "" {
+                namespace = binding.Metadata.Namespace
+            }
+            if flags.Namespace != "" && namespace != flags.Namespace {
+                continue // only the ServiceAccounts of --namespace were read
+            }
+            switch {
+            case !namespaceExists[namespace]:
+                orphans = append(orphans, orphan{"missing subject", binding.Kind, binding.Metadata.Namespace, binding.Metadata.Name, "ServiceAccount " + namespace + "/" + subject.Name + ": namespace does not exist"})
+            case !serviceAccountExists[namespace+"/"+subject.Name]:
+                orphans = append(orphans, orphan{"missing subject", binding.Kind, binding.Metadata.Namespace, binding.Metadata.Name, "ServiceAccount " + namespace + "/" + subject.Name + " does not exist"})
+            }
+        }
+    }
+
+    // ClusterRoles feeding an aggregated ClusterRole are in use even without a binding
+    for _, role := range data.ClusterRoles {
+        for _, name := range role.AggregatedFrom {
+            referenced["ClusterRole/"+name] = true
+        }
+    }
+    for _, role := range data.Roles {
+        if referenced["Role/"+role.Metadata.Namespace+"/"+role.Metadata.Name] || flags.ExcludeSystem && isSystemPrefix(role.Metadata.Name, systemPrefixes) {
+            continue
+        }
+        orphans = append(orphans, orphan{"unreferenced role", "Role", role.Metadata.Namespace, role.Metadata.Name, "no binding refers to it"})
+    }
+    // with --namespace, bindings of other namespaces may still use a ClusterRole
+    if flags.Namespace == "" {
+        for _, role := range data.ClusterRoles {
+            if referenced["ClusterRole/"+role.Metadata.Name] || flags.ExcludeSystem && isSystemPrefix(role.Metadata.Name, systemPrefixes) {
+                continue
+            }
+            orphans = append(orphans, orphan{"unreferenced role", "ClusterRole", "", role.Metadata.Name, "no binding refers to it"})
+        }
+    }
+
+    problemOrder := map[string]int{"dangling roleRef": 0, "missing subject": 1, "unreferenced role": 2}
+    sort.SliceStable(orphans, func(i, j int) bool {
+        if orphans[i].Problem != orphans[j].Problem {
+            return problemOrder[orphans[i].Problem] < problemOrder[orphans[j].Problem]
+        }
+        if orphans[i].Kind != orphans[j].Kind {
+            return orphans[i].Kind < orphans[j].Kind
+        }
+        if orphans[i].Namespace != orphans[j].Namespace {
+            return orphans[i].Namespace < orphans[j].Namespace
+        }
+        return orphans[i].Name < orphans[j].Name
+    })
+    return orphans
+}
+
+// whether ServiceAccount subjects can be checked: a cluster always has its ServiceAccounts, offline files may not
+func hasServiceAccounts(source *rbacSource) bool {
+    if source.client == nil && source.objects["serviceaccounts"] == nil {
+        fmt.Fprintln(os.Stderr, "# No ServiceAccounts in the input; ServiceAccount subjects are not checked")
+        return false
+    }
+    return true
+}
+
+func displayOrphans(orphans []orphan) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+    fmt.Fprintln(w, "Problem\tKind\tNamespace\tName\tDetail")
+    fmt.Fprintln(w, "-------\t----\t---------\t----\t------")
+    for _, o := range orphans {
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", o.Problem, o.Kind, o.Namespace, o.Name, o.Detail)
+    }
+    w.Flush()
+}
+
+func saveOrphansCSV(orphans []orphan) {
+    file, err := os.Create("orphans.csv")
+    if err != nil {
+        log.Fatal("Cannot create file", err)
+    }
+    defer file.Close()
+
+    writer := csv.NewWriter(file)
+    defer writer.Flush()
+
+    writer.Write([]string{"Problem", "Kind", "Namespace", "Name", "Detail"})
+    for _, o := range orphans {
+        writer.Write([]string{o.Problem, o.Kind, o.Namespace, o.Name, o.Detail})
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// check: evaluates one request against the loaded RBAC model, the way the Kubernetes RBAC authorizer does,
+// and shows which binding, role and rule allow it. Works on live clusters, --from files and snapshots alike.
+// ---------------------------------------------------------------------------------------
+
+type accessRequest struct {
+    Verb          string
+    APIGroup      string
+    GroupGuessed  bool   // no group was given and discovery data couldn't resolve it, so the core group is assumed
+    Resource      string // "pods", or "pods/log" for a subresource
+    Name          string // --name; rules limited to resourceNames only allow requests for a named object
+    AnyName       bool   // rules limited to resourceNames allow it too, for any name they list
+    Namespace     string // "" for cluster-wide requests
+    AllNamespaces bool   // who-can without a namespace: RoleBindings of every namespace apply
+    URL           string // set instead of Resource for non-resource requests such as /metrics
+}
+
+// one binding subject and rule that allow a request
+type grant struct {
+    Binding RoleBinding
+    Subject BindingSubject
+    Role    Role
+    Rule    RoleRule
+}
+
+// Builds a request from "<resource>[.<group>][/<subresource>]" or a non-resource URL. Without a group, the group is
+// looked up in the discovery data; if that is not possible, the core group is assumed (see ambiguousGroups).
+func newAccessRequest(ctx context.Context, source *rbacSource, verb string, target string, name string, namespace string) accessRequest {
+    request := accessRequest{Verb: verb, Name: name, Namespace: namespace}
+    if strings.HasPrefix(target, "/") {
+        request.URL = target
+        return request
+    }
+
+    resource, subresource := target, ""
+    if slash := strings.Index(target, "/"); slash >= 0 {
+        resource, subresource = target[:slash], target[slash+1:]
+    }
+    if dot := strings.Index(resource, "."); dot >= 0 {
+        resource, request.APIGroup = resource[:dot], resource[dot+1:]
+    } else {
+        request.GroupGuessed = true
+        if lists, err := apiResources(ctx, source); err == nil {
+            for _, list := range lists {
+                for _, candidate := range list.Resources {
+                    if candidate.Name == resource {
+                        request.APIGroup, request.GroupGuessed = groupOf(list.GroupVersion), false
+                        break
+                    }
+                }
+                if !request.GroupGuessed {
+                    break
+                }
+            }
+        }
+    }
+    request.Resource = resource
+    if subresource != "" {
+        request.Resource += "/" + subresource
+    }
+    return request
+}
+
+func (r accessRequest) String() string {
+    if r.URL != "" {
+        return r.Verb + " " + r.URL
+    }
+    text := r.Verb + " " + r.Resource
+    if r.APIGroup != "" {
+        text += " (apiGroup " + r.APIGroup + ")"
+    }
+    if r.Name != "" {
+        text += " named " + r.Name
+    }
+    if r.Namespace != "" {
+        return text + " in namespace " + r.Namespace
+    }
+    if r.AllNamespaces {
+        return text + " in any namespace"
+    }
+    return text + " cluster-wide"
+}
+
+// reports whether one rule allows the request
+func ruleAllows(rule RoleRule, request accessRequest) bool {
+    verbOK := false
+    for _, verb := range rule.Verbs {
+        if verb == "*" || verb == request.Verb {
+            verbOK = true
+        }
+    }
+    if !verbOK {
+        return false
+    }
+
+    if request.URL != "" {
+        for _, url := range rule.NonResourceURLs {
+            if url == "*" || url == request.URL || strings.HasSuffix(url, "*") && strings.HasPrefix(request.URL, strings.TrimSuffix(url, "*")) {
+                return true
+            }
+        }
+        return false
+    }
+
+    groupOK := false
+    for _, apiGroup := range rule.APIGroups {
+        if apiGroup == "*" || apiGroup == request.APIGroup {
+            groupOK = true
+        }
+    }
+    if !groupOK {
+        return false
+    }
+    resourceOK := false
+    for _, resource := range rule.Resources {
+        // "*/scale" allows the scale subresource of every resource
+        if resource == "*" || resource == request.Resource || strings.HasPrefix(resource, "*/") && strings.HasSuffix(request.Resource, resource[1:]) {
+            resourceOK = true
+        }
+    }
+    if !resourceOK {
+        return false
+    }
+    if len(rule.ResourceNames) == 0 || request.AnyName {
+        return true
+    }
+    for _, name := range rule.ResourceNames {
+        if name == request.Name {
+            return true
+        }
+    }
+    return false
+}
+
+// The API groups other than the core group that rules name the resource in. When the group of a request was
+// guessed and there are any, the answer can't be trusted: "deployments" is most likely deployments.apps.
+func ambiguousGroups(data *rbacData, request accessRequest) []string {
+    if !request.GroupGuessed {
+        return nil
+    }
+    found := make(map[string]bool)
+    var roles []Role
+    roles = append(roles, data.ClusterRoles...)
+    roles = append(roles, data.Roles...)
+    for _, role := range roles {
+        for _, rule := range role.Rules {
+            for _, resource := range rule.Resources {
+                if resource != request.Resource {
+                    continue
+                }
+                for _, apiGroup := range rule.APIGroups {
+                    if apiGroup != "" && apiGroup != "*" {
+                        found[apiGroup] = true
+                    }
+                }
+            }
+        }
+    }
+    var groups []string
+    for apiGroup := range found {
+        groups = append(groups, apiGroup)
+    }
+    sort.Strings(groups)
+    return groups
+}
+
+// the roles by roleRefKey, to resolve the roleRef of a binding
+func roleIndex(data *rbacData) map[string]Role {
+    roles := make(map[string]Role)
+    for _, role := range data.Roles {
+        roles["Role/"+role.Metadata.Namespace+"/"+role.Metadata.Name] = role
+    }
+    for _, role := range data.ClusterRoles {
+        roles["ClusterRole/"+role.Metadata.Name] = role
+    }
+    return roles
+}
+
+// a Role is looked up in the binding's namespace, a ClusterRole by name
+func roleRefKey(binding RoleBinding) string {
+    if binding.RoleRef.Kind == "Role" {
+        return "Role/" + binding.Metadata.Namespace + "/" + binding.RoleRef.Name
+    }
+    return "ClusterRole/" + binding.RoleRef.Name
+}
+
+// Every binding subject and rule that allows the request. ClusterRoleBindings apply everywhere; RoleBindings only
+// to requests in their namespace, and never to cluster-wide or non-resource requests.
+func findGrants(data *rbacData, request accessRequest) []grant {
+    roles := roleIndex(data)
+
+    var grants []grant
+    var bindings []RoleBinding
+    bindings = append(bindings, data.ClusterRoleBindings...)
+    for _, binding := range data.RoleBindings {
+        if request.URL == "" && (request.AllNamespaces || request.Namespace != "" && binding.Metadata.Namespace == request.Namespace) {
+            bindings = append(bindings, binding)
+        }
+    }
+    for _, binding := range bindings {
+        role, ok := roles[roleRefKey(binding)]
+        if !ok {
+            continue
+        }
+        for _, rule := range role.Rules {
+            if !ruleAllows(rule, request) {
+                continue
+            }
+            for _, subject := range binding.Subjects {
+                grants = append(grants, grant{binding, subject, role, rule})
+            }
+        }
+    }
+    return grants
+}
+
+// Parses the subject of 'check': "alice" or "User:alice", "Group:devs", "ServiceAccount:ns/name" or
+// "system:serviceaccount:ns:name", the user name a ServiceAccount authenticates as.
+func parseSubject(text string) (BindingSubject, error) {
+    if strings.HasPrefix(text, "system:serviceaccount:") {
+        parts := strings.Split(strings.TrimPrefix(text, "system:serviceaccount:"), ":")
+        if len(parts) != 2 {
+            return BindingSubject{}, fmt.Errorf("expected system:serviceaccount:<namespace>:<name>, got %q", text)
+        }
+        return BindingSubject{Kind: "ServiceAccount", Namespace: parts[0], Name: parts[1]}, nil
+    }
+    kind, name := "User", text
+    if colon := strings.Index(text, ":"); colon >= 0 {
+        switch text[:colon] {
+        case "User", "Group", "ServiceAccount":
+            kind, name = text[:colon], text[colon+1:]
+        }
+    }
+    if kind == "ServiceAccount" {
+        slash := strings.Index(name, "/")
+        if slash < 0 {
+            return BindingSubject{}, fmt.Errorf("expected ServiceAccount:<namespace>/<name>, got %q", text)
+        }
+        return BindingSubject{Kind: kind, Namespace: name[:slash], Name: name[slash+1:]}, nil
+    }
+    return normalizeSubject(BindingSubject{Kind: kind, Name: name}), nil
+}
+
+func subjectString(subject BindingSubject) string {
+    if subject.Namespace != "" {
+        return subject.Kind + " " + subject.Namespace + "/" + subject.Name
+    }
+    return subject.Kind + " " + subject.Name
+}
+
+// the groups a subject is in: the implicit system groups, and for Users the groups of --group-members
+func subjectGroups(subject BindingSubject) []string {
+    groups := implicitGroups(subject.Kind, subject.Name, subject.Namespace)
+    if subject.Kind == "User" {
+        var members []string
+        for group, users := range GROUPMEMBERS {
+            for _, user := range users {
+                if user == subject.Name {
+                    members = append(members, group)
+                }
+            }
+        }
+        sort.Strings(members)
+        groups = append(groups, members...)
+    }
+    return groups
+}
+
+// A User named system:serviceaccount:<namespace>:<name> is the ServiceAccount to the API server.
+func normalizeSubject(subject BindingSubject) BindingSubject {
+    if subject.Kind == "User" && strings.HasPrefix(subject.Name, "system:serviceaccount:") {
+        if account, err := parseSubject(subject.Name); err == nil {
+            return account
+        }
+    }
+    return subject
+}
+
+// Reports whether a binding subject stands for the queried subject, directly or through one of its groups;
+// via names that group. A ServiceAccount subject without a namespace is in the binding's namespace.
+func subjectMatches(bound BindingSubject, binding RoleBinding, subject BindingSubject, groups []string) (matched bool, via string) {
+    bound, subject = normalizeSubject(bound), normalizeSubject(subject)
+    switch bound.Kind {
+    case "Group":
+        if subject.Kind == "Group" && bound.Name == subject.Name {
+            return true, ""
+        }
+        for _, group := range groups {
+            if bound.Name == group {
+                return true, group
+            }
+        }
+    case "ServiceAccount":
+        namespace := bound.Namespace
+        if namespace == "" {
+            namespace = binding.Metadata.Namespace
+        }
+        return subject.Kind == "ServiceAccount" && bound.Name == subject.Name && namespace == subject.Namespace, ""
+    default:
+        return bound.Kind == subject.Kind && bound.Name == subject.Name, ""
+    }
+    return false, ""
+}
+
+// the binding a grant comes from, as "Kind namespace/name"
+func grantBinding(g grant) string {
+    if g.Binding.Metadata.Namespace != "" {
+        return g.Binding.Kind + " " + g.Binding.Metadata.Namespace + "/" + g.Binding.Metadata.Name
+    }
+    return g.Binding.Kind + " " + g.Binding.Metadata.Name
+}
+
+func grantRole(g grant) string {
+    if g.Role.Metadata.Namespace != "" {
+        return g.Role.Kind + " " + g.Role.Metadata.Namespace + "/" + g.Role.Metadata.Name
+    }
+    return g.Role.Kind + " " + g.Role.Metadata.Name
+}
+
+func grantRule(g grant) string {
+    var cells []string
+    for _, cell := range ruleCells(g.Rule) {
+        apiGroup := cell[0]
+        if apiGroup == "" {
+            apiGroup = `""`
+        }
+        cells = append(cells, apiGroup+" "+cell[1])
+    }
+    return strings.Join(cells, ", ") + " [" + verbsCell(g.Rule.Verbs) + "]"
+}
+
+// Answers yes or no; unknown (returns false) when the API group of the resource can't be told, so a "yes" is never
+// given for a rule of another group.
+func runCheck(ctx context.Context, source *rbacSource, data *rbacData, flags InputFlags) (bool, error) {
+    subject, err := parseSubject(flags.CheckArgs[0])
+    if err != nil {
+        return false, err
+    }
+    request := newAccessRequest(ctx, source, flags.CheckArgs[1], flags.CheckArgs[2], flags.ObjectName, flags.Namespace)
+    if others := ambiguousGroups(data, request); len(others) > 0 {
+        fmt.Printf("unknown - no discovery data to find the API group of %s, and rules name it in %s. Use %s.<group>, e.g. %s.%s\n",
+            request.Resource, strings.Join(others, ", "), request.Resource, request.Resource, others[0])
+        return false, nil
+    }
+    groups := subjectGroups(subject)
+
+    var matched []grant
+    var vias []string
+    for _, g := range findGrants(data, request) {
+        if ok, via := subjectMatches(g.Subject, g.Binding, subject, groups); ok {
+            matched = append(matched, g)
+            vias = append(vias, via)
+        }
+    }
+
+    if request.GroupGuessed {
+        fmt.Fprintln(os.Stderr, "# No discovery data to find the API group of", request.Resource+"; the core group is assumed. Use <resource>.<group> to be exact.")
+    }
+    if len(matched) == 0 {
+        fmt.Printf("no - no RBAC rule allows %s to %s\n", subjectString(subject), request)
+        return true, nil
+    }
+    fmt.Printf("yes - %s may %s\n\n", subjectString(subject), request)
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+    fmt.Fprintln(w, "Binding\tSubject\tRole\tRule")
+    fmt.Fprintln(w, "-------\t-------\t----\t----")
+    for i, g := range matched {
+        subjectCell := subjectString(g.Subject)
+        if vias[i] != "" {
+            subjectCell += " (member)"
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", grantBinding(g), subjectCell, grantRole(g), grantRule(g))
+    }
+    w.Flush()
+    return true, nil
+}
+
+
+// ---------------------------------------------------------------------------------------
+// who-can: the reverse of check, every subject a request is allowed for
+// ---------------------------------------------------------------------------------------
+
+// Lists the subjects; false when the API group of the resource can't be told, as for check. Without --name,
+// subjects limited to some objects by resourceNames are listed too, with the names in the Names column.
+func runWhoCan(ctx context.Context, source *rbacSource, data *rbacData, flags InputFlags) bool {
+    request := newAccessRequest(ctx, source, flags.CheckArgs[0], flags.CheckArgs[1], flags.ObjectName, flags.Namespace)
+    // without a namespace, RoleBindings of every namespace count, each for its own namespace
+    request.AllNamespaces = flags.Namespace == ""
+    request.AnyName = flags.ObjectName == ""
+    if others := ambiguousGroups(data, request); len(others) > 0 {
+        fmt.Printf("Unknown - no discovery data to find the API group of %s, and rules name it in %s. Use %s.<group>, e.g. %s.%s\n",
+            request.Resource, strings.Join(others, ", "), request.Resource, request.Resource, others[0])
+        return false
+    }
+    grants := findGrants(data, request)
+
+    type row struct {
+        Subject string
+        Where   string
+        Names   string
+        Grant   grant
+    }
+    var rows []row
+    for _, g := range grants {
+        where := "*"
+        if g.Binding.Metadata.Namespace != "" {
+            where = g.Binding.Metadata.Namespace
+        }
+        names := "*"
+        if request.Name != "" {
+            names = request.Name
+        } else if len(g.Rule.ResourceNames) > 0 {
+            names = strings.Join(g.Rule.ResourceNames, ", ")
+        }
+        subject := g.Subject
+        if subject.Kind == "ServiceAccount" && subject.Namespace == "" {
+            subject.Namespace = g.Binding.Metadata.Namespace
+        }
+        rows = append(rows, row{subjectString(subject), where, names, g})
+        // with --group-members, the members of a group can do it too
+        if subject.Kind == "Group" {
+            for _, member := range GROUPMEMBERS[subject.Name] {
+                rows = append(rows, row{"User " + member + " (group " + subject.Name + ")", where, names, g})
+            }
+        }
+    }
+    sort.SliceStable(rows, func(i, j int) bool {
+        if rows[i].Subject != rows[j].Subject {
+            return rows[i].Subject < rows[j].Subject
+        }
+        return rows[i].Where < rows[j].Where
+    })
+
+    if request.GroupGuessed {
+        fmt.Fprintln(os.Stderr, "# No discovery data to find the API group of", request.Resource+"; the core group is assumed. Use <resource>.<group> to be exact.")
+    }
+    if len(rows) == 0 {
+        fmt.Printf("No subject may %s\n", request)
+        return true
+    }
+    fmt.Printf("Subjects that may %s\n\n", request)
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+    fmt.Fprintln(w, "Subject\tNamespace\tNames\tBinding\tRole\tRule")
+    fmt.Fprintln(w, "-------\t---------\t-----\t-------\t----\t----")
+    for _, r := range rows {
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Subject, r.Where, r.Names, grantBinding(r.Grant), grantRole(r.Grant), grantRule(r.Grant))
+    }
+    w.Flush()
+    return true
+}
+
+
+// ---------------------------------------------------------------------------------------
+// --overpowered: checks every account's rules against a built-in catalog of dangerous
+// permissions, and lists each finding with a severity
+// ---------------------------------------------------------------------------------------
+
+var severityRank = map[string]int{"low": 1, "medium": 2, "high": 3, "critical": 4}
+
+// one dangerous permission of the catalog
+type riskCheck struct {
+    Severity    string
+    Finding     string
+    ClusterOnly bool // only on cluster-scoped resources, so a RoleBinding can't grant it
+    Supersedes  bool // a binding it matches needs no other check of the catalog
+    Matches     func(rule RoleRule) bool
+}
+
+type riskFinding struct {
+    Severity string
+    Finding  string
+    Scope    string // "cluster", or the namespace of the RoleBinding
+    Binding  BindingInfo
+    Rule     RoleRule
+}
+
+type riskReport struct {
+    Account  AccountInfo
+    Severity string // the highest severity of its findings
+    Findings []riskFinding
+}
+
+// Reports whether the rule allows one of the verbs on one of the resources. A rule limited to resourceNames counts:
+// bind on clusterroles named cluster-admin is as dangerous as bind on every role.
+func allowsAny(rule RoleRule, verbs []string, apiGroup string, resources ...string) bool {
+    for _, verb := range verbs {
+        for _, resource := range resources {
+            if ruleAllows(rule, accessRequest{Verb: verb, APIGroup: apiGroup, Resource: resource, AnyName: true}) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// non-resource rules don't count, their wildcards only cover URLs
+func hasWildcard(rule RoleRule, values []string) bool {
+    if len(rule.Resources) == 0 {
+        return false
+    }
+    for _, value := range values {
+        if value == "*" {
+            return true
+        }
+    }
+    return false
+}
+
+var writeVerbs = []string{"create", "update", "patch", "delete"}
+
+// findings are listed in this order within a severity
+var riskCatalog = []riskCheck{
+    {"critical", "cluster-admin equivalent (all verbs on all resources)", false, true, func(rule RoleRule) bool {
+        return allowsAny(rule, []string{"*"}, "*", "*") && len(rule.ResourceNames) == 0
+    }},
+    {"critical", "escalate: may create roles with permissions it doesn't have", false, false, func(rule RoleRule) bool {
+        return allowsAny(rule, []string{"escalate"}, "rbac.authorization.k8s.io", "roles", "clusterroles")
+    }},
+    {"critical", "bind: may bind roles it doesn't hold, such as cluster-admin", false, false, func(rule RoleRule) bool {
+        return allowsAny(rule, []string{"bind"}, "rbac.authorization.k8s.io", "roles", "clusterroles")
+    }},
+    {"critical", "impersonate: may act as other users, groups or ServiceAccounts", false, false, func(rule RoleRule) bool {
+        return allowsAny(rule, []string{"impersonate"}, "", "users", "groups", "serviceaccounts") ||
+            allowsAny(rule, []string{"impersonate"}, "authentication.k8s.io", "userextras", "uids")
+    }},
+    {"critical", "nodes/proxy: kubelet API access, runs commands in any pod of a node", true, false, func(rule RoleRule) bool {
+        return allowsAny(rule, []string{"get", "create"}, "", "nodes/proxy")
+    }},
+    {"high", "wildcard resources (*): also covers resources added later", false, false, func(rule RoleRule) bool {
+        return hasWildcard(rule, rule.Resources)
+    }},
+    {"high", "reads secrets", false, false, func(rule RoleRule) bool {
+        return allowsAny(rule, []string{"get", "list", "watch"}, "", "secrets")
+    }},
+    {"high", "pods/exec or pods/attach: runs commands in running containers", false, false, func(rule RoleRule) bool {
+        return allowsAny(rule, []string{"create", "get"}, "", "pods/exec", "pods/attach")
+    }},
+    {"high", "serviceaccounts/token: issues tokens of ServiceAccounts", false, false, func(rule RoleRule) bool {
+        return allowsAny(rule, []string{"create"}, "", "serviceaccounts/token")
+    }},
+    {"high", "approves certificate signing requests", true, false, func(rule RoleRule) bool {
+        return allowsAny(rule, []string{"update", "patch"}, "certificates.k8s.io", "certificatesigningrequests/approval")
+    }},
+    {"high", "writes admission webhook configurations", true, false, func(rule RoleRule) bool {
+        return allowsAny(rule, writeVerbs, "admissionregistration.k8s.io", "mutatingwebhookconfigurations", "validatingwebhookconfigurations")
+    }},
+    {"medium", "creates pods or workloads, which may run as any ServiceAccount of the namespace", false, false, func(rule RoleRule) bool {
+        return allowsAny(rule, []string{"create"}, "", "pods", "replicationcontrollers") ||
+            allowsAny(rule, []string{"create"}, "apps", "deployments", "daemonsets", "statefulsets", "replicasets") ||
+            allowsAny(rule, []string{"create"}, "batch", "jobs", "cronjobs")
+    }},
+    {"medium", "wildcard verbs (*): also covers escalate, bind and impersonate where they apply", false, false, func(rule RoleRule) bool {
+        return hasWildcard(rule, rule.Verbs)
+    }},
+}
+
+// A finding through a RoleBinding only counts in its namespace, so it is one severity lower.
+func lowerSeverity(severity string) string {
+    switch severity {
+    case "critical":
+        return "high"
+    case "high":
+        return "medium"
+    }
+    return "low"
+}
+
+// checks the rules of every account (built with --more) against the catalog; accounts without findings are left out
+func assessAccounts(accounts []AccountInfo) []riskReport {
+    var reports []riskReport
+    for _, account := range accounts {
+        report := riskReport{Account: account}
+        seen := make(map[string]bool)
+        for _, binding := range account.Bindings {
+            scope := "cluster"
+            if binding.Namespace != "" {
+                scope = binding.Namespace
+            }
+            // a binding to an admin role only gets that finding
+            rules := binding.ExtraRules
+            checks := riskCatalog
+            for _, check := range riskCatalog {
+                for _, rule := range binding.ExtraRules {
+                    if check.Supersedes && check.Matches(rule) {
+                        rules, checks = []RoleRule{rule}, []riskCheck{check}
+                    }
                 }
             }
-
-            if len(orStrings) == 0 {
-                orStrings = append(orStrings, "-")
+            for _, rule := range rules {
+                for _, check := range checks {
+                    if scope != "cluster" && check.ClusterOnly || !check.Matches(rule) {
+                        continue
+                    }
+                    finding := riskFinding{check.Severity, check.Finding, scope, binding, rule}
+                    if len(rule.ResourceNames) > 0 {
+                        finding.Finding += " (only: " + strings.Join(rule.ResourceNames, ", ") + ")"
+                    }
+                    if scope != "cluster" {
+                        finding.Severity = lowerSeverity(check.Severity)
+                        if check.Supersedes {
+                            finding.Finding = "admin of the namespace (all verbs on all resources)"
+                        }
+                    }
+                    // the same finding through the same binding and role is reported once
+                    key := strings.Join([]string{finding.Finding, scope, bindingKindCell(binding), binding.RoleRefKind, binding.RoleRefName}, "\x00")
+                    if !seen[key] {
+                        seen[key] = true
+                        report.Findings = append(report.Findings, finding)
+                        if severityRank[finding.Severity] > severityRank[report.Severity] {
+                            report.Severity = finding.Severity
+                        }
+                    }
+                }
             }
+        }
+        if len(report.Findings) == 0 {
+            continue
+        }
+        sort.SliceStable(report.Findings, func(i, j int) bool {
+            return severityRank[report.Findings[i].Severity] > severityRank[report.Findings[j].Severity]
+        })
+        reports = append(reports, report)
+    }
+    sort.SliceStable(reports, func(i, j int) bool {
+        return severityRank[reports[i].Severity] > severityRank[reports[j].Severity]
+    })
+    return reports
+}
 
-            if flags.ExtendedOption {
-                // Print first OwnerReference with other details
-                fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", binding.Metadata.Name, binding.RoleRef.Kind, binding.RoleRef.Name, binding.Subjects[0].Kind, binding.Subjects[0].Name, namespace, orStrings[0])
-                // Print remaining OwnerReferences
-                for _, orString := range orStrings[1:] {
-                    fmt.Fprintf(w, "%s\n", orString)
-                }
+func overpoweredAccounts(clusters []clusterData, flags InputFlags) ([]riskReport, error) {
+    // the catalog works on the rules of each binding
+    flags.MoreOption = true
+    accounts, err := buildUserList(clusters, flags)
+    if err != nil {
+        return nil, err
+    }
+    return assessAccounts(accounts), nil
+}
+
+func riskRule(rule RoleRule) string {
+    return grantRule(grant{Rule: rule})
+}
+
+func displayRiskReports(reports []riskReport, flags InputFlags) {
+    if len(reports) == 0 {
+        fmt.Println("No account holds a permission of the risk catalog.")
+        return
+    }
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+    fmt.Fprintln(w, clusterCell(flags, "Cluster")+"Account Name\tID Type\tSeverity\tFinding\tScope\tKind\tRoleRefName\tRoleRefKind\tRule")
+    fmt.Fprintln(w, clusterCell(flags, "-------")+"------------\t-------\t--------\t-------\t-----\t----\t-----------\t-----------\t----")
+    for _, report := range reports {
+        account := report.Account
+        for i, finding := range report.Findings {
+            if i == 0 {
+                fmt.Fprintf(w, "%s%s\t%s\t", clusterCell(flags, account.Cluster), accountName(account), account.Type)
             } else {
-                // Just print without OwnerReferences
-                fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", binding.Metadata.Name, binding.RoleRef.Kind, binding.RoleRef.Name, binding.Subjects[0].Kind, binding.Subjects[0].Name, namespace)
+                fmt.Fprintf(w, "%s\t\t", clusterCell(flags, ""))
             }
-            fmt.Fprintln(w, separator)
+            fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", strings.ToUpper(finding.Severity), finding.Finding, finding.Scope, bindingKindCell(finding.Binding), finding.Binding.RoleRefName, finding.Binding.RoleRefKind, riskRule(finding.Rule))
         }
+        fmt.Fprintln(w, clusterCell(flags, "-------")+"------------\t-------\t--------\t-------\t-----\t----\t-----------\t-----------\t----")
     }
     w.Flush()
 }
 
+func saveRiskReportsCSV(reports []riskReport, flags InputFlags) {
+    file, err := os.Create("overpowered.csv")
+    if err != nil {
+        log.Fatal("Cannot create file", err)
+    }
+    defer file.Close()
 
+    writer := csv.NewWriter(file)
+    defer writer.Flush()
 
-func displayRoleBindings(bindings []RoleBinding, flags InputFlags, systemPrefixes []string) {
-    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
-    fmt.Fprintln(w, "Kind\tBinding Name\tAllows to (namespace)\tRole Kind\tLink to (Role Name)\tSubject Kind\tSubject Name\tSubject Namespace")
-    fmt.Fprintln(w, "----\t------------\t---------\t---------\t-------\t------------\t------------\t-----------------")
+    var lead []string
+    if isMultiCluster(flags) {
+        lead = []string{"Cluster"}
+    }
+    writer.Write(append(lead, "Account Name", "Account Type", "Account Namespace", "Severity", "Finding", "Scope", "Kind", "RoleRefName", "RoleRefKind", "Rule"))
+    for _, report := range reports {
+        account := report.Account
+        for _, finding := range report.Findings {
+            var record []string
+            if isMultiCluster(flags) {
+                record = append(record, account.Cluster)
+            }
+            record = append(record, account.Name, account.Type, account.Namespace, finding.Severity, finding.Finding, finding.Scope, bindingKindCell(finding.Binding), finding.Binding.RoleRefName, finding.Binding.RoleRefKind, riskRule(finding.Rule))
+            writer.Write(record)
+        }
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// escalation-paths: chains of permissions that lead a subject to a higher privilege level,
+// e.g. "create pods in X" -> run as X's ServiceAccount -> that ServiceAccount's ClusterRoleBinding
+// ---------------------------------------------------------------------------------------
+
+// at most this many paths are printed
+const maxEscalationPaths = 20
+
+// A node of the graph: a subject whose permissions can be used, or a privilege level (Level) reached by
+// changing RBAC itself, e.g. binding cluster-admin with the "bind" verb.
+type escalationNode struct {
+    Subject BindingSubject
+    Level   string // "cluster-admin" or "namespace-admin:<namespace>"
+}
+
+// one edge: what the subject does to get to the next node, and the grants that together let it
+type escalationStep struct {
+    To     escalationNode
+    Action string
+    Grants []grant
+}
+
+type escalationGraph struct {
+    data            *rbacData
+    roles           map[string]Role
+    namespaces      []string
+    serviceAccounts map[string][]BindingSubject // by namespace
+    users           []BindingSubject
+    groups          []BindingSubject
+    steps           map[string][]escalationStep // by nodeKey, filled as the graph is walked
+    grants          map[string][]grant          // by nodeKey, filled as the graph is walked
+}
+
+func nodeKey(node escalationNode) string {
+    if node.Level != "" {
+        return node.Level
+    }
+    return subjectString(node.Subject)
+}
+
+func nodeString(node escalationNode) string {
+    if strings.HasPrefix(node.Level, "namespace-admin:") {
+        return "admin of namespace " + strings.TrimPrefix(node.Level, "namespace-admin:")
+    }
+    if node.Level != "" {
+        return node.Level
+    }
+    return subjectString(node.Subject)
+}
+
+// Collects the subjects of all bindings. Every namespace has a "default" ServiceAccount, and ServiceAccounts of
+// the input (if it has any) are added, so "create pods in X" leads somewhere even without a binding in X.
+func newEscalationGraph(data *rbacData) *escalationGraph {
+    g := &escalationGraph{data: data, roles: roleIndex(data), serviceAccounts: make(map[string][]BindingSubject), steps: make(map[string][]escalationStep), grants: make(map[string][]grant)}
+    seen := make(map[string]bool)
+    namespaces := make(map[string]bool)
+    add := func(subject BindingSubject) {
+        subject = normalizeSubject(subject)
+        if seen[subjectString(subject)] {
+            return
+        }
+        seen[subjectString(subject)] = true
+        switch subject.Kind {
+        case "ServiceAccount":
+            g.serviceAccounts[subject.Namespace] = append(g.serviceAccounts[subject.Namespace], subject)
+            namespaces[subject.Namespace] = true
+        case "User":
+            g.users = append(g.users, subject)
+        case "Group":
+            g.groups = append(g.groups, subject)
+        }
+    }
+    var bindings []RoleBinding
+    bindings = append(bindings, data.ClusterRoleBindings...)
+    bindings = append(bindings, data.RoleBindings...)
+    for _, binding := range bindings {
+        if binding.Metadata.Namespace != "" {
+            namespaces[binding.Metadata.Namespace] = true
+        }
+        for _, subject := range binding.Subjects {
+            if subject.Kind == "ServiceAccount" && subject.Namespace == "" {
+                subject.Namespace = binding.Metadata.Namespace
+            }
+            add(BindingSubject{Kind: subject.Kind, Name: subject.Name, Namespace: subject.Namespace})
+        }
+    }
+    for _, role := range data.Roles {
+        namespaces[role.Metadata.Namespace] = true
+    }
+    for _, object := range data.Namespaces {
+        namespaces[object.Metadata.Name] = true
+    }
+    for _, object := range data.ServiceAccounts {
+        add(BindingSubject{Kind: "ServiceAccount", Name: object.Metadata.Name, Namespace: object.Metadata.Namespace})
+    }
+    for namespace := range namespaces {
+        add(BindingSubject{Kind: "ServiceAccount", Name: "default", Namespace: namespace})
+        g.namespaces = append(g.namespaces, namespace)
+    }
+    // system:masters bypasses RBAC, so impersonating it is enough
+    add(BindingSubject{Kind: "Group", Name: "system:masters"})
+    sort.Strings(g.namespaces)
+    for _, list := range g.serviceAccounts {
+        sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+    }
+    sort.Slice(g.users, func(i, j int) bool { return g.users[i].Name < g.users[j].Name })
+    sort.Slice(g.groups, func(i, j int) bool { return g.groups[i].Name < g.groups[j].Name })
+    return g
+}
 
+// every rule the subject holds, directly or through its groups; computed once per subject
+func (g *escalationGraph) subjectGrants(subject BindingSubject) []grant {
+    key := subjectString(subject)
+    if grants, ok := g.grants[key]; ok {
+        return grants
+    }
+    groups := subjectGroups(subject)
+    var grants []grant
+    var bindings []RoleBinding
+    bindings = append(bindings, g.data.ClusterRoleBindings...)
+    bindings = append(bindings, g.data.RoleBindings...)
     for _, binding := range bindings {
-        if flags.ExcludeSystem && isSystemPrefix(binding.Metadata.Name, systemPrefixes) {
+        role, ok := g.roles[roleRefKey(binding)]
+        if !ok {
             continue
         }
-        displayedHeader := false
-        for index, subject := range binding.Subjects {
-            namespace := subject.Namespace
-            if namespace == "" {
-                namespace = "-"
+        for _, bound := range binding.Subjects {
+            if matched, _ := subjectMatches(bound, binding, subject, groups); !matched {
+                continue
+            }
+            for _, rule := range role.Rules {
+                grants = append(grants, grant{binding, bound, role, rule})
             }
+            break
+        }
+    }
+    g.grants[key] = grants
+    return grants
+}
 
-            if !displayedHeader {
-		// if it's a Workspace(a Concept from Kubesphere) do this. because the "workspace" is not describe in Metadata.Namespace
-		workspaceName, exists := binding.Metadata.Labels["kubesphere.io/workspace"]
-		if exists {
-		    fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", binding.Kind, binding.Metadata.Name, workspaceName, binding.RoleRef.Kind, binding.RoleRef.Name, subject.Kind, subject.Name, namespace)
-		} else {
-		    fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", binding.Kind, binding.Metadata.Name, binding.Metadata.Namespace, binding.RoleRef.Kind, binding.RoleRef.Name, subject.Kind, subject.Name, namespace)
-		}
+// Reports whether the node holds the target level itself, and the grant that gives it (none for levels and
+// system:masters). Target is "cluster-admin" or "namespace-admin:<namespace>".
+func (g *escalationGraph) reaches(node escalationNode, target string) (bool, *grant) {
+    if node.Level != "" {
+        return node.Level == target || node.Level == "cluster-admin", nil
+    }
+    if node.Subject.Kind == "Group" && node.Subject.Name == "system:masters" {
+        return true, nil
+    }
+    for _, held := range g.subjectGrants(node.Subject) {
+        scope := held.Binding.Metadata.Namespace
+        if (scope == "" || "namespace-admin:"+scope == target) && allowsUnnamed(held.Rule, []string{"*"}, "*", "*") {
+            return true, &held
+        }
+    }
+    return false, nil
+}
 
-                    displayedHeader = true
-                } else {
-		    fmt.Fprintf(w, "\t\t\t\t\t%s\t%s\t%s\n", subject.Kind, subject.Name, namespace)
-                }
+// Like allowsAny, but a rule limited to resourceNames doesn't count: which pod or Secret belongs to which
+// ServiceAccount can't be told from RBAC data, and create requests carry no name.
+func allowsUnnamed(rule RoleRule, verbs []string, apiGroup string, resources ...string) bool {
+    return allowsAny(rule, verbs, apiGroup, resources...) && len(rule.ResourceNames) == 0
+}
 
-            // Only print the separator line after the last subject of a binding
-            if index == len(binding.Subjects) - 1 {
-                fmt.Fprintln(w, "----\t------------\t---------\t---------\t-------\t------------\t------------\t-----------------")
-            }
+// the first grant of the subject that allows the request; a RoleBinding's grants only count in its namespace
+func (g *escalationGraph) allows(subject BindingSubject, request accessRequest) *grant {
+    for _, held := range g.subjectGrants(subject) {
+        if scope := held.Binding.Metadata.Namespace; scope != "" && scope != request.Namespace {
+            continue
+        }
+        if ruleAllows(held.Rule, request) {
+            return &held
         }
     }
-    w.Flush()
+    return nil
 }
 
+// the first grant that allows one of the verbs on the named object
+func (g *escalationGraph) allowsVerbs(subject BindingSubject, verbs []string, resource string, name string, namespace string) *grant {
+    for _, verb := range verbs {
+        if held := g.allows(subject, accessRequest{Verb: verb, APIGroup: "rbac.authorization.k8s.io", Resource: resource, Name: name, Namespace: namespace}); held != nil {
+            return held
+        }
+    }
+    return nil
+}
 
-// user list table create & sort, merge
-
-func processBindings(clusterRoles []Role, roles []Role, clusterRoleBindings []RoleBinding, roleBindings []RoleBinding, flags InputFlags) ([]AccountInfo, error) {
-    // 초기화: USERLIST
-    USERLIST = []AccountInfo{}
-    containsRoleBinding := false
-    containsClusterRoleBinding := false
-    
-    for _, option:= range flags.OnlyOption {
-	if option == "rolebinding" {
-	    containsRoleBinding = true
-	} else if option == "clusterrolebinding" {
-	    containsClusterRoleBinding = true
-	}
+// the namespaces a grant applies to: its RoleBinding's, or all of them for a ClusterRoleBinding
+func (g *escalationGraph) grantNamespaces(held grant) []string {
+    if held.Binding.Metadata.Namespace != "" {
+        return []string{held.Binding.Metadata.Namespace}
     }
+    return g.namespaces
+}
 
-	
+// Steps that change RBAC itself. Each needs every permission the API server checks for it: "bind" on the role and
+// create on the binding, or "escalate" and update on a role that is already bound to the subject.
+func (g *escalationGraph) rbacSteps(subject BindingSubject, add func(to escalationNode, action string, grants ...grant)) {
+    clusterAdmin := escalationNode{Level: "cluster-admin"}
+    if bind := g.allowsVerbs(subject, []string{"bind"}, "clusterroles", "cluster-admin", ""); bind != nil {
+        if create := g.allowsVerbs(subject, []string{"create"}, "clusterrolebindings", "", ""); create != nil {
+            add(clusterAdmin, "create a ClusterRoleBinding to ClusterRole cluster-admin", *bind, *create)
+        }
+    }
 
-    // ClusterRoleBinding 데이터 처리
-    // if flags.OnlyOption == "" || flags.OnlyOption == "clusterrolebinding" {
-    if len(flags.OnlyOption) == 0 || containsClusterRoleBinding {
-	for _, clusterBinding := range clusterRoleBindings {
-            for _, subject := range clusterBinding.Subjects {
-//	    if subject.Kind == "User" && (!excludeSystem || !strings.HasPrefix(subject.Name, "system:")){
-//	    if subject.Kind == "User" && !strings.HasPrefix(subject.Name, "system:"){
-	        if subject.Kind == "User" || flags.Service && subject.Kind == "ServiceAccount" {
-                    info := BindingInfo{
-                        Kind:        clusterBinding.Kind,
-                        RoleRefName: clusterBinding.RoleRef.Name,
-                        RoleRefKind: clusterBinding.RoleRef.Kind,
-                    }
-                    addToTable(subject.Name, subject.Kind, info)
-                }
+    for _, namespace := range g.namespaces {
+        namespaceAdmin := escalationNode{Level: "namespace-admin:" + namespace}
+        create := g.allowsVerbs(subject, []string{"create"}, "rolebindings", "", namespace)
+        if create == nil {
+            continue
+        }
+        // a RoleBinding to a ClusterRole needs "bind" on the ClusterRole in the RoleBinding's namespace
+        for _, role := range []string{"cluster-admin", "admin"} {
+            if bind := g.allowsVerbs(subject, []string{"bind"}, "clusterroles", role, namespace); bind != nil {
+                add(namespaceAdmin, "create a RoleBinding to ClusterRole "+role+" in namespace "+namespace, *bind, *create)
+                break
             }
         }
+        // with "escalate" a Role may hold permissions its creator doesn't have; the name of a new Role isn't
+        // known in advance, so only rules without resourceNames count
+        escalate := g.allowsVerbs(subject, []string{"escalate"}, "roles", "", namespace)
+        createRole := g.allowsVerbs(subject, []string{"create"}, "roles", "", namespace)
+        bindRole := g.allowsVerbs(subject, []string{"bind"}, "roles", "", namespace)
+        if escalate != nil && createRole != nil && bindRole != nil {
+            add(namespaceAdmin, "create a Role with every permission of namespace "+namespace+" and a RoleBinding to it", *escalate, *createRole, *bindRole, *create)
+        }
     }
 
-    // RoleBinding 데이터 처리
-    //if flags.OnlyOption == "" || flags.OnlyOption == "rolebinding" {
-    if len(flags.OnlyOption) == 0 || containsRoleBinding {
-        for _, roleBinding := range roleBindings {
-            for _, subject := range roleBinding.Subjects {
-//	    if subject.Kind == "User" && (!excludeSystem || !strings.HasPrefix(subject.Name, "system:")){
-//	    if subject.Kind == "User" && !strings.HasPrefix(subject.Name, "system:"){
-	        if subject.Kind == "User" || flags.Service && subject.Kind == "ServiceAccount" {
-                    info := BindingInfo{
-                        Kind:        roleBinding.Kind,
-                        Namespace:   roleBinding.Metadata.Namespace,
-                        RoleRefName: roleBinding.RoleRef.Name,
-                        RoleRefKind: roleBinding.RoleRef.Kind,
-                    }
-                    addToTable(subject.Name, subject.Kind, info)
+    // adding every permission to a role the subject is bound to
+    for _, held := range g.subjectGrants(subject) {
+        role := held.Role
+        to := clusterAdmin
+        if held.Binding.Metadata.Namespace != "" {
+            to = escalationNode{Level: "namespace-admin:" + held.Binding.Metadata.Namespace}
+        }
+        resource := "clusterroles"
+        if role.Kind == "Role" {
+            resource = "roles"
+        }
+        escalate := g.allowsVerbs(subject, []string{"escalate"}, resource, role.Metadata.Name, role.Metadata.Namespace)
+        update := g.allowsVerbs(subject, []string{"update", "patch"}, resource, role.Metadata.Name, role.Metadata.Namespace)
+        if escalate != nil && update != nil {
+            add(to, "add every permission to "+grantRole(held)+", bound to it by "+grantBinding(held), *escalate, *update, held)
+        }
+    }
+}
+
+// the edges leaving a subject, one per target node and action
+func (g *escalationGraph) stepsFrom(node escalationNode) []escalationStep {
+    if node.Level != "" {
+        return nil
+    }
+    key := nodeKey(node)
+    if steps, ok := g.steps[key]; ok {
+        return steps
+    }
+    var steps []escalationStep
+    seen := make(map[string]bool)
+    add := func(to escalationNode, action string, grants ...grant) {
+        if nodeKey(to) == key || seen[nodeKey(to)+"\x00"+action] {
+            return
+        }
+        seen[nodeKey(to)+"\x00"+action] = true
+        // one rule may allow several of the permissions a step needs
+        var unique []grant
+        listed := make(map[string]bool)
+        for _, held := range grants {
+            if text := grantBinding(held) + grantRole(held) + grantRule(held); !listed[text] {
+                listed[text] = true
+                unique = append(unique, held)
+            }
+        }
+        steps = append(steps, escalationStep{to, action, unique})
+    }
+    // names limits the ServiceAccounts to those of a rule's resourceNames
+    toServiceAccounts := func(held grant, namespaces []string, action string, names []string) {
+        named := make(map[string]bool)
+        for _, name := range names {
+            named[name] = true
+        }
+        for _, namespace := range namespaces {
+            for _, account := range g.serviceAccounts[namespace] {
+                if len(names) == 0 || named[account.Name] {
+                    add(escalationNode{Subject: account}, fmt.Sprintf(action, account.Namespace+"/"+account.Name), held)
                 }
             }
         }
     }
+    // to the users or groups of a rule's resourceNames, or all of them
+    toSubjects := func(held grant, kind string, subjects []BindingSubject) {
+        if len(held.Rule.ResourceNames) > 0 {
+            subjects = nil
+            for _, name := range held.Rule.ResourceNames {
+                subjects = append(subjects, normalizeSubject(BindingSubject{Kind: kind, Name: name}))
+            }
+        }
+        for _, subject := range subjects {
+            add(escalationNode{Subject: subject}, "impersonate "+subjectString(subject), held)
+        }
+    }
 
-    sortTable()
-    mergeAccounts()
+    g.rbacSteps(node.Subject, add)
+    for _, held := range g.subjectGrants(node.Subject) {
+        rule := held.Rule
+        namespaces := g.grantNamespaces(held)
+        clusterWide := held.Binding.Metadata.Namespace == ""
 
-    // return VALUES that processed USERLIST
-    return USERLIST, nil
+        if allowsUnnamed(rule, []string{"create"}, "", "pods", "replicationcontrollers") ||
+            allowsUnnamed(rule, []string{"create"}, "apps", "deployments", "daemonsets", "statefulsets", "replicasets") ||
+            allowsUnnamed(rule, []string{"create"}, "batch", "jobs", "cronjobs") {
+            toServiceAccounts(held, namespaces, "create a pod that runs as ServiceAccount %s", nil)
+        }
+        // the name of a token request is the ServiceAccount's
+        if allowsAny(rule, []string{"create"}, "", "serviceaccounts/token") {
+            toServiceAccounts(held, namespaces, "request a token for ServiceAccount %s", rule.ResourceNames)
+        }
+        if allowsUnnamed(rule, []string{"get", "list"}, "", "secrets") {
+            toServiceAccounts(held, namespaces, "read the token Secret of ServiceAccount %s", nil)
+        }
+        if allowsUnnamed(rule, []string{"create", "get"}, "", "pods/exec", "pods/attach") {
+            toServiceAccounts(held, namespaces, "exec into a pod running as ServiceAccount %s", nil)
+        }
+        if allowsAny(rule, []string{"impersonate"}, "", "serviceaccounts") {
+            toServiceAccounts(held, namespaces, "impersonate ServiceAccount %s", rule.ResourceNames)
+        }
+        if clusterWide && allowsUnnamed(rule, []string{"get", "create"}, "", "nodes/proxy") {
+            toServiceAccounts(held, g.namespaces, "exec through the kubelet API (nodes/proxy) into a pod of ServiceAccount %s", nil)
+        }
+        if clusterWide && allowsAny(rule, []string{"impersonate"}, "", "users") {
+            toSubjects(held, "User", g.users)
+        }
+        if clusterWide && allowsAny(rule, []string{"impersonate"}, "", "groups") {
+            toSubjects(held, "Group", g.groups)
+        }
+    }
+    g.steps[key] = steps
+    return steps
 }
 
-func processKubeSphereBindings(clusterRoles []Role, roles []Role, workspaceRoles []Role, globalRoles []Role, clusterRoleBindings []RoleBinding, roleBindings []RoleBinding, workspaceRoleBindings []RoleBinding, globalRoleBindings []RoleBinding, flags InputFlags) ([]AccountInfo, error) {
-    // 초기화: USERLIST
-    USERLIST = []AccountInfo{}
-    containsRoleBinding := false
-    containsClusterRoleBinding := false
-    containsWorkspaceRoleBinding := false
-    containsGlobalRoleBinding := false
-    
-    for _, option:= range flags.OnlyOption {
-	if option == "rolebinding" {
-	    containsRoleBinding = true
-	} else if option == "clusterrolebinding" {
-	    containsClusterRoleBinding = true 
-	} else if option == "workspacerolebinding" {
-	    containsWorkspaceRoleBinding = true
-	} else if option == "globalrolebinding" {
-	    containsGlobalRoleBinding = true
-	}
+// A breadth-first search from the subject that keeps the step each node was first reached by, so every path is a
+// shortest one. Returns one path per node that holds the target level, nearest first; the search doesn't go on
+// from such a node.
+func (g *escalationGraph) paths(start escalationNode, target string) [][]escalationStep {
+    type visit struct {
+        From string // nodeKey of the previous node, "" for the start
+        Step escalationStep
     }
-
-    if len(flags.OnlyOption) == 0 || containsClusterRoleBinding {
-	for _, clusterBinding := range clusterRoleBindings {
-            for _, subject := range clusterBinding.Subjects {
-	        if subject.Kind == "User" || flags.Service && subject.Kind == "ServiceAccount" {
-                    info := BindingInfo{
-                        Kind:        clusterBinding.Kind,
-                        RoleRefName: clusterBinding.RoleRef.Name,
-                        RoleRefKind: clusterBinding.RoleRef.Kind,
-                    }
-                    addToTable(subject.Name, subject.Kind, info)
-                }
+    visited := map[string]visit{nodeKey(start): {}}
+    var reached []string
+    queue := []escalationNode{start}
+    for len(queue) > 0 {
+        node := queue[0]
+        queue = queue[1:]
+        for _, step := range g.stepsFrom(node) {
+            key := nodeKey(step.To)
+            if _, ok := visited[key]; ok {
+                continue
             }
+            visited[key] = visit{nodeKey(node), step}
+            if ok, _ := g.reaches(step.To, target); ok {
+                reached = append(reached, key)
+                continue
+            }
+            queue = append(queue, step.To)
         }
     }
 
-    if len(flags.OnlyOption) == 0 || containsRoleBinding {
-        for _, roleBinding := range roleBindings {
-            for _, subject := range roleBinding.Subjects {
-	        if subject.Kind == "User" || flags.Service && subject.Kind == "ServiceAccount" {
-                    info := BindingInfo{
-                        Kind:        roleBinding.Kind,
-                        Namespace:   roleBinding.Metadata.Namespace,
-                        RoleRefName: roleBinding.RoleRef.Name,
-                        RoleRefKind: roleBinding.RoleRef.Kind,
-                    }
-                    addToTable(subject.Name, subject.Kind, info)
-                }
-            }
+    var paths [][]escalationStep
+    for _, key := range reached {
+        var path []escalationStep
+        for key != nodeKey(start) {
+            path = append([]escalationStep{visited[key].Step}, path...)
+            key = visited[key].From
         }
+        paths = append(paths, path)
     }
+    return paths
+}
 
-    if containsWorkspaceRoleBinding {
-	for _, workspaceBinding := range workspaceRoleBindings {
-            for _, subject := range workspaceBinding.Subjects {
-	        if subject.Kind == "User" || flags.Service && subject.Kind == "ServiceAccount" {
-                    info := BindingInfo{
-                        Kind:        workspaceBinding.Kind,
-			Namespace:   workspaceBinding.Metadata.Labels["kubesphere.io/workspace"],
-                        RoleRefName: workspaceBinding.RoleRef.Name,
-                        RoleRefKind: workspaceBinding.RoleRef.Kind,
-                    }
-                    addToTable(subject.Name, subject.Kind, info)
-                }
-            }
+func targetString(target string) string {
+    return nodeString(escalationNode{Level: target})
+}
+
+func runEscalationPaths(data *rbacData, flags InputFlags) error {
+    subject, err := parseSubject(flags.CheckArgs[0])
+    if err != nil {
+        return err
+    }
+    target := flags.Target
+    if target == "" {
+        target = "cluster-admin"
+    }
+    if target != "cluster-admin" && !(strings.HasPrefix(target, "namespace-admin:") && len(target) > len("namespace-admin:")) {
+        return fmt.Errorf("unknown target %q, expected cluster-admin or namespace-admin:<namespace>", target)
+    }
+
+    graph := newEscalationGraph(data)
+    start := escalationNode{Subject: normalizeSubject(subject)}
+    if ok, held := graph.reaches(start, target); ok {
+        fmt.Printf("%s already is %s", subjectString(subject), targetString(target))
+        if held != nil {
+            fmt.Printf(" (%s -> %s)", grantBinding(*held), grantRole(*held))
         }
+        fmt.Println()
+        return nil
     }
 
-    if containsGlobalRoleBinding {
-	for _, globalBinding := range globalRoleBindings {
-            for _, subject := range globalBinding.Subjects {
-	        if subject.Kind == "User" || flags.Service && subject.Kind == "ServiceAccount" {
-                    info := BindingInfo{
-                        Kind:        globalBinding.Kind,
-                        RoleRefName: globalBinding.RoleRef.Name,
-                        RoleRefKind: globalBinding.RoleRef.Kind,
-                    }
-                    addToTable(subject.Name, subject.Kind, info)
-                }
+    paths := graph.paths(start, target)
+    if len(paths) == 0 {
+        fmt.Printf("No escalation path from %s to %s.\n", subjectString(subject), targetString(target))
+        return nil
+    }
+    fmt.Printf("Escalation paths from %s to %s (the shortest one to each subject that gets there):\n", subjectString(subject), targetString(target))
+    for i, path := range paths {
+        if i == maxEscalationPaths {
+            fmt.Printf("\n... and %d more paths\n", len(paths)-maxEscalationPaths)
+            break
+        }
+        fmt.Printf("\n%d. %s\n", i+1, subjectString(subject))
+        for _, step := range path {
+            fmt.Printf("   -> %s\n", step.Action)
+            for _, held := range step.Grants {
+                fmt.Printf("      (%s -> %s: %s)\n", grantBinding(held), grantRole(held), grantRule(held))
             }
+            if step.To.Level == "" {
+                fmt.Printf("   = %s\n", nodeString(step.To))
+            }
+        }
+        last := path[len(path)-1].To
+        if _, held := graph.reaches(last, target); held != nil {
+            fmt.Printf("   => %s (%s -> %s)\n", targetString(target), grantBinding(*held), grantRole(*held))
+        } else {
+            fmt.Printf("   => %s\n", targetString(target))
         }
     }
+    return nil
+}
 
 
-    sortTable()
-    mergeAccounts()
+// ---------------------------------------------------------------------------------------
+// lint: evaluates the rules of a local policy file against the account model of 'get user',
+// and exits with 1 on violations so it can gate CI pipelines
+// ---------------------------------------------------------------------------------------
 
-    // return VALUES that processed USERLIST
-    return USERLIST, nil
+type lintPolicy struct {
+    Rules []lintRule `json:"rules"`
 }
 
-func addToTable(name string, kind string, info BindingInfo) {
-    for i, account := range USERLIST {
-        if account.Name == name {
-            USERLIST[i].Bindings = append(account.Bindings, info)
-            return
-        }
-    }
-    USERLIST = append(USERLIST, AccountInfo{Name: name, Type: kind, Bindings: []BindingInfo{info}})
+// A policy rule: the accounts selected by Subjects, minus Except, must not hold a binding that matches Bindings
+// and (if given) allows one of Permissions. Bindings of the default policy are skipped unless Defaults is set.
+type lintRule struct {
+    Name        string       `json:"name"`
+    Description string       `json:"description,omitempty"`
+    Severity    string       `json:"severity,omitempty"` // "error" (default) fails the run, "warning" is only reported
+    Subjects    lintSubjects `json:"subjects,omitempty"`
+    Except      []string     `json:"except,omitempty"` // subjects as for 'check', with * patterns: "Group:platform-admins", "ServiceAccount:kube-system/*"
+    Bindings    lintBindings `json:"bindings,omitempty"`
+    Permissions []RoleRule   `json:"permissions,omitempty"` // apiGroups (default ""), resources and verbs
+    Defaults    bool         `json:"includeDefaults,omitempty"` // also check the default bindings of Kubernetes
 }
 
-func sortTable() {
-    sort.Slice(USERLIST, func(i, j int) bool {
-        if USERLIST[i].Name != USERLIST[j].Name {
-            return USERLIST[i].Name < USERLIST[j].Name
+// every list is optional; * patterns are allowed in names and namespaces
+type lintSubjects struct {
+    Kinds      []string `json:"kinds,omitempty"`      // User, Group, ServiceAccount
+    Names      []string `json:"names,omitempty"`
+    Namespaces []string `json:"namespaces,omitempty"` // of ServiceAccounts
+}
+
+type lintBindings struct {
+    Kinds      []string `json:"kinds,omitempty"`      // RoleBinding, ClusterRoleBinding, ...
+    Namespaces []string `json:"namespaces,omitempty"` // of RoleBindings
+    Roles      []string `json:"roles,omitempty"`      // roleRef names
+}
+
+type lintViolation struct {
+    Rule    lintRule
+    Account AccountInfo
+    Binding BindingInfo
+    Detail  string // the rule of the role that allows a forbidden permission
+}
+
+func loadLintPolicy(path string) (*lintPolicy, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var policy lintPolicy
+    if err := decodeYAML(data, &policy); err != nil {
+        return nil, err
+    }
+    if len(policy.Rules) == 0 {
+        return nil, fmt.Errorf("%s has no rules", path)
+    }
+    for i, rule := range policy.Rules {
+        if rule.Name == "" {
+            return nil, fmt.Errorf("rule %d has no name", i+1)
         }
-        for k := range USERLIST[i].Bindings {
-            if USERLIST[i].Bindings[k].Kind != USERLIST[j].Bindings[k].Kind {
-                return USERLIST[i].Bindings[k].Kind < USERLIST[j].Bindings[k].Kind
+        if rule.Severity != "" && rule.Severity != "error" && rule.Severity != "warning" {
+            return nil, fmt.Errorf("rule %s: severity must be error or warning, got %q", rule.Name, rule.Severity)
+        }
+        for _, kind := range rule.Subjects.Kinds {
+            if kind != "User" && kind != "Group" && kind != "ServiceAccount" {
+                return nil, fmt.Errorf("rule %s: unknown subject kind %q", rule.Name, kind)
             }
-            if USERLIST[i].Bindings[k].Namespace != USERLIST[j].Bindings[k].Namespace {
-                return USERLIST[i].Bindings[k].Namespace < USERLIST[j].Bindings[k].Namespace
+        }
+        for _, pattern := range rule.Except {
+            if _, err := parseSubject(pattern); err != nil {
+                return nil, fmt.Errorf("rule %s: %v", rule.Name, err)
             }
-            if USERLIST[i].Bindings[k].RoleRefName != USERLIST[j].Bindings[k].RoleRefName {
-                return USERLIST[i].Bindings[k].RoleRefName < USERLIST[j].Bindings[k].RoleRefName
+        }
+        for j, permission := range rule.Permissions {
+            if len(permission.Verbs) == 0 || len(permission.Resources) == 0 {
+                return nil, fmt.Errorf("rule %s: permission %d needs verbs and resources", rule.Name, j+1)
             }
-            if USERLIST[i].Bindings[k].RoleRefKind != USERLIST[j].Bindings[k].RoleRefKind {
-                return USERLIST[i].Bindings[k].RoleRefKind < USERLIST[j].Bindings[k].RoleRefKind
+            if len(permission.APIGroups) == 0 {
+                policy.Rules[i].Permissions[j].APIGroups = []string{""}
             }
         }
-        return false
-    })
+    }
+    return &policy, nil
 }
 
-func mergeAccounts() {
-    for i := 0; i < len(USERLIST); i++ {
-        for j := i + 1; j < len(USERLIST); j++ {
-            if USERLIST[i].Name == USERLIST[j].Name {
-                USERLIST[i].Bindings = append(USERLIST[i].Bindings, USERLIST[j].Bindings...)
-                USERLIST = append(USERLIST[:j], USERLIST[j+1:]...)
-                j--
-            }
+// an empty pattern list matches everything
+func matchesAny(patterns []string, value string) bool {
+    if len(patterns) == 0 {
+        return true
+    }
+    for _, pattern := range patterns {
+        if ok, _ := filepath.Match(pattern, value); ok {
+            return true
         }
     }
+    return false
 }
 
-func attachExtra(accounts []AccountInfo, refinedClusterRoles []Role, refinedRoles []Role) []AccountInfo {
-    for i, account := range accounts {
-        for j, binding := range account.Bindings {
-            if binding.RoleRefKind == "Role" {
-                for _, role := range refinedRoles {
-                    if role.Metadata.Name == binding.RoleRefName {
-                        accounts[i].Bindings[j].ExtraRules = append(binding.ExtraRules, role.Rules...)
-                        break
-                    }
-                }
-            } else if binding.RoleRefKind == "ClusterRole" {
-                for _, clusterRole := range refinedClusterRoles {
-                    if clusterRole.Metadata.Name == binding.RoleRefName {
-                        accounts[i].Bindings[j].ExtraRules = append(binding.ExtraRules, clusterRole.Rules...)
-                        break
-                    }
+// reports whether one of the except patterns stands for the subject
+func excepted(patterns []string, subject BindingSubject) bool {
+    for _, pattern := range patterns {
+        except, _ := parseSubject(pattern)
+        if except.Kind != subject.Kind {
+            continue
+        }
+        name, _ := filepath.Match(except.Name, subject.Name)
+        namespace, _ := filepath.Match(except.Namespace, subject.Namespace)
+        if name && namespace {
+            return true
+        }
+    }
+    return false
+}
+
+// the first role rule of the binding that allows one of the permissions, if any
+func forbiddenRule(binding BindingInfo, permissions []RoleRule) (RoleRule, bool) {
+    for _, rule := range binding.ExtraRules {
+        for _, permission := range permissions {
+            for _, apiGroup := range permission.APIGroups {
+                if allowsAny(rule, permission.Verbs, apiGroup, permission.Resources...) {
+                    return rule, true
                 }
             }
         }
     }
-    return accounts
+    return RoleRule{}, false
 }
 
-
-func attachKubeSphereExtra(accounts []AccountInfo, refinedClusterRoles []Role, refinedRoles []Role, refinedWorkspaceRoles []Role, refinedGlobalRoles []Role) []AccountInfo {
-    for i, account := range accounts {
-        for j, binding := range account.Bindings {
-            if binding.RoleRefKind == "Role" {
-                for _, role := range refinedRoles {
-                    if role.Metadata.Name == binding.RoleRefName {
-                        accounts[i].Bindings[j].ExtraRules = append(binding.ExtraRules, role.Rules...)
-                        break
-                    }
+func evaluatePolicy(policy *lintPolicy, accounts []AccountInfo) []lintViolation {
+    var violations []lintViolation
+    for _, rule := range policy.Rules {
+        for _, account := range accounts {
+            subject := BindingSubject{Kind: account.Type, Name: account.Name, Namespace: account.Namespace}
+            if !matchesAny(rule.Subjects.Kinds, account.Type) || !matchesAny(rule.Subjects.Names, account.Name) || excepted(rule.Except, subject) {
+                continue
+            }
+            if len(rule.Subjects.Namespaces) > 0 && (account.Type != "ServiceAccount" || !matchesAny(rule.Subjects.Namespaces, account.Namespace)) {
+                continue
+            }
+            for _, binding := range account.Bindings {
+                // the default policy (system:basic-user for system:authenticated, the controllers' bindings, ...)
+                // is on every cluster, so it only counts when the rule asks for it
+                if binding.Default && !rule.Defaults {
+                    continue
                 }
-            } else if binding.RoleRefKind == "ClusterRole" {
-                for _, clusterRole := range refinedClusterRoles {
-                    if clusterRole.Metadata.Name == binding.RoleRefName {
-                        accounts[i].Bindings[j].ExtraRules = append(binding.ExtraRules, clusterRole.Rules...)
-                        break
+                // a binding inherited from an excepted group is allowed
+                if binding.ViaGroup != "" && excepted(rule.Except, BindingSubject{Kind: "Group", Name: binding.ViaGroup}) {
+                    continue
+                }
+                if !matchesAny(rule.Bindings.Kinds, binding.Kind) || !matchesAny(rule.Bindings.Roles, binding.RoleRefName) {
+                    continue
+                }
+                if len(rule.Bindings.Namespaces) > 0 && (binding.Namespace == "" || !matchesAny(rule.Bindings.Namespaces, binding.Namespace)) {
+                    continue
+                }
+                violation := lintViolation{Rule: rule, Account: account, Binding: binding}
+                if len(rule.Permissions) > 0 {
+                    matched, ok := forbiddenRule(binding, rule.Permissions)
+                    if !ok {
+                        continue
                     }
+                    violation.Detail = riskRule(matched)
                 }
+                violations = append(violations, violation)
             }
         }
     }
-    return accounts
+    return violations
 }
 
+// Prints the violations and returns the number of errors among them.
+func runLint(clusters []clusterData, flags InputFlags) (int, error) {
+    policy, err := loadLintPolicy(flags.PolicyPath)
+    if err != nil {
+        return 0, fmt.Errorf("reading policy: %v", err)
+    }
+    // every kind of account with the bindings of its implicit groups, with the rules of its roles
+    flags.Service, flags.Groups, flags.Implicit, flags.MoreOption, flags.OnlyOption = true, true, true, true, nil
+    accounts, err := buildUserList(clusters, flags)
+    if err != nil {
+        return 0, err
+    }
+    violations := evaluatePolicy(policy, accounts)
 
+    errors := 0
+    for _, violation := range violations {
+        if violation.Rule.Severity != "warning" {
+            errors++
+        }
+    }
+    fmt.Printf("Policy %s: %d rules, %d violations (%d errors, %d warnings)\n", flags.PolicyPath, len(policy.Rules), len(violations), errors, len(violations)-errors)
+    if len(violations) == 0 {
+        return 0, nil
+    }
+    fmt.Println()
 
-func displayProcessedTable(accounts []AccountInfo, flags InputFlags) {
     w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
-
-    if flags.MoreOption {
-        fmt.Fprintln(w, "Account Name\tID Type\tKind\tNamespace\tRoleRefName\tRoleRefKind\tapiGroups\tResources\tVerbs")
-        fmt.Fprintln(w, "------------\t-------\t----\t---------\t-----------\t-----------\t---------\t---------\t-----")
-    } else {
-        fmt.Fprintln(w, "Account Name\tID Type\tKind\tNamespace\tRoleRefName\tRoleRefKind")
-        fmt.Fprintln(w, "------------\t-------\t----\t---------\t-----------\t-----------")
+    fmt.Fprintln(w, clusterCell(flags, "Cluster")+"Severity\tRule\tAccount Name\tID Type\tKind\tNamespace\tRoleRefName\tRoleRefKind\tDetail")
+    fmt.Fprintln(w, clusterCell(flags, "-------")+"--------\t----\t------------\t-------\t----\t---------\t-----------\t-----------\t------")
+    for _, violation := range violations {
+        severity := violation.Rule.Severity
+        if severity == "" {
+            severity = "error"
+        }
+        fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", clusterCell(flags, violation.Account.Cluster), strings.ToUpper(severity), violation.Rule.Name, accountName(violation.Account), violation.Account.Type, bindingKindCell(violation.Binding), violation.Binding.Namespace, violation.Binding.RoleRefName, violation.Binding.RoleRefKind, violation.Detail)
     }
+    w.Flush()
+    return errors, nil
+}
 
-    prevAccountName := ""
-    prevRoleRefName := ""
-    prevBindingNamespace := ""
 
-    for _, account := range accounts {
-        displayAccountName := true
+// ---------------------------------------------------------------------------------------
+// benchmark cis: the RBAC controls of CIS Kubernetes Benchmark section 5.1, evaluated against
+// the loaded data, each with a result and the evidence behind it
+// ---------------------------------------------------------------------------------------
 
-        for _, binding := range account.Bindings {
-            if flags.MoreOption && (binding.RoleRefName != prevRoleRefName || binding.Namespace != prevBindingNamespace) && prevRoleRefName != "" {
-                if account.Name == prevAccountName {
-                    fmt.Fprintln(w, "\t\t----\t---------\t-----------\t-----------\t---------\t---------\t-----")
-                } else {
-                    fmt.Fprintln(w, "------------\t-------\t----\t---------\t-----------\t-----------\t---------\t---------\t-----")
-                }
-            }
+// Kubernetes labels the roles and bindings of its default policy with this
+const bootstrapLabel = "kubernetes.io/bootstrapping"
 
-	    // "ServiceAccount" to "Service", for short name
-            var idType string
-            if account.Type == "ServiceAccount" {
-                idType = "Service"
-            } else {
-                idType = account.Type
-            }
+type cisControl struct {
+    ID       string
+    Title    string
+    Result   string // PASS, WARN, FAIL or MANUAL
+    Evidence []string
+}
 
-            if displayAccountName {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s", account.Name, idType, binding.Kind, binding.Namespace, binding.RoleRefName, binding.RoleRefKind)
-                displayAccountName = false
-            } else {
-                fmt.Fprintf(w, "\t\t%s\t%s\t%s\t%s", binding.Kind, binding.Namespace, binding.RoleRefName, binding.RoleRefKind)
+// Every subject and rule the bindings grant, except the default policy of Kubernetes and, with --nosys,
+// bindings and subjects with a system prefix.
+func cisGrants(data *rbacData, flags InputFlags, systemPrefixes []string) []grant {
+    roles := roleIndex(data)
+    var grants []grant
+    var bindings []RoleBinding
+    bindings = append(bindings, data.ClusterRoleBindings...)
+    bindings = append(bindings, data.RoleBindings...)
+    for _, binding := range bindings {
+        if binding.Metadata.Labels[bootstrapLabel] == "rbac-defaults" {
+            continue
+        }
+        if flags.ExcludeSystem && isSystemPrefix(binding.Metadata.Name, systemPrefixes) {
+            continue
+        }
+        role, ok := roles[roleRefKey(binding)]
+        if !ok {
+            continue
+        }
+        for _, subject := range binding.Subjects {
+            if subject.Kind == "ServiceAccount" && subject.Namespace == "" {
+                subject.Namespace = binding.Metadata.Namespace
             }
-
-            if flags.MoreOption && len(binding.ExtraRules) > 0 {
-                rule := binding.ExtraRules[0] // start with the first rule
-                fmt.Fprintf(w, "\t%s\t%s\t[%s]\n", rule.APIGroups[0], rule.Resources[0], strings.Join(rule.Verbs, ", "))
-
-                for _, rule := range binding.ExtraRules[1:] { // skip the first rule since we already displayed it
-                    for _, apiGroup := range rule.APIGroups {
-                        for _, resource := range rule.Resources {
-                            fmt.Fprintf(w, "\t\t\t\t\t\t%s\t%s\t[%s]\n", apiGroup, resource, strings.Join(rule.Verbs, ", "))
-                        }
-                    }
-                }
-            } else {
-                fmt.Fprintln(w)
+            if flags.ExcludeSystem && isSystemPrefix(subject.Name, systemPrefixes) {
+                continue
+            }
+            for _, rule := range role.Rules {
+                grants = append(grants, grant{binding, subject, role, rule})
             }
-
-            prevRoleRefName = binding.RoleRefName // 현재 RoleRefName을 저장
-            prevAccountName = account.Name        // 현재 Account Name을 저장
-            prevBindingNamespace = binding.Namespace // 현재 Namespace를 저장
         }
+    }
+    return grants
+}
 
-        if !flags.MoreOption {
-            fmt.Fprintln(w, "------------\t-------\t----\t---------\t-----------\t-----------")
+// nonResourceURLs such as "*" or "/api/*"
+func hasURLWildcard(rule RoleRule) bool {
+    for _, url := range rule.NonResourceURLs {
+        if strings.Contains(url, "*") {
+            return true
         }
     }
-    w.Flush()
+    return false
 }
 
+func grantEvidence(g grant) string {
+    return subjectString(g.Subject) + ": " + grantBinding(g) + " -> " + grantRole(g) + ": " + grantRule(g)
+}
 
+func isClusterAdminBinding(binding RoleBinding) bool {
+    return binding.RoleRef.Kind == "ClusterRole" && binding.RoleRef.Name == "cluster-admin"
+}
 
-func saveAsCSV(accounts []AccountInfo, flags InputFlags) {
-    var filename string
-
-    if flags.MoreOption {
-        filename = "userListExtended.csv"
-    } else {
-        filename = "userList.csv"
+// A control that fails with every grant the predicate matches. Grants whose rules are limited to resourceNames
+// give the named result instead, unless another grant fails the control; the evidence lists the names. Bindings of
+// cluster-admin allow everything and are listed under 5.1.1 only.
+func grantControl(id string, title string, grants []grant, named string, matches func(g grant) bool) cisControl {
+    control := cisControl{ID: id, Title: title, Result: "PASS"}
+    seen := make(map[string]bool)
+    for _, g := range grants {
+        if isClusterAdminBinding(g.Binding) || !matches(g) {
+            continue
+        }
+        evidence := grantEvidence(g)
+        if !seen[evidence] {
+            seen[evidence] = true
+            control.Evidence = append(control.Evidence, evidence)
+            if len(g.Rule.ResourceNames) == 0 {
+                control.Result = "FAIL"
+            } else if control.Result == "PASS" {
+                control.Result = named
+            }
+        }
     }
+    return control
+}
 
-    file, err := os.Create(filename)
-    if err != nil {
-        log.Fatal("Cannot create file", err)
+func evaluateCIS(data *rbacData, flags InputFlags, systemPrefixes []string) []cisControl {
+    grants := cisGrants(data, flags, systemPrefixes)
+    var controls []cisControl
+
+    // 5.1.1 lists bindings rather than rules: one line per subject
+    clusterAdmin := cisControl{ID: "5.1.1", Title: "Ensure that the cluster-admin role is only used where required", Result: "PASS"}
+    seen := make(map[string]bool)
+    for _, g := range grants {
+        if isClusterAdminBinding(g.Binding) {
+            evidence := subjectString(g.Subject) + ": " + grantBinding(g)
+            if !seen[evidence] {
+                seen[evidence] = true
+                clusterAdmin.Evidence = append(clusterAdmin.Evidence, evidence)
+                clusterAdmin.Result = "FAIL"
+            }
+        }
     }
-    defer file.Close()
+    controls = append(controls, clusterAdmin)
 
-    writer := csv.NewWriter(file)
-    defer writer.Flush()
+    controls = append(controls, grantControl("5.1.2", "Minimize access to secrets", grants, "WARN", func(g grant) bool {
+        return allowsAny(g.Rule, []string{"get", "list", "watch"}, "", "secrets")
+    }))
 
-    if flags.MoreOption {
-        writer.Write([]string{"Account Name", "Account Type", "Kind", "Namespace", "RoleRefName", "RoleRefKind", "apiGroups", "Resources", "Verbs"})
-    } else {
-        writer.Write([]string{"Account Name", "Account Type", "Kind", "Namespace", "RoleRefName", "RoleRefKind"})
+    // 5.1.3 is about the roles themselves, bound or not
+    wildcards := cisControl{ID: "5.1.3", Title: "Minimize wildcard use in Roles and ClusterRoles", Result: "PASS"}
+    var roles []Role
+    roles = append(roles, data.ClusterRoles...)
+    roles = append(roles, data.Roles...)
+    for _, role := range roles {
+        if role.Metadata.Labels[bootstrapLabel] == "rbac-defaults" || flags.ExcludeSystem && isSystemPrefix(role.Metadata.Name, systemPrefixes) {
+            continue
+        }
+        for _, rule := range role.Rules {
+            if hasWildcard(rule, rule.Verbs) || hasWildcard(rule, rule.Resources) || hasWildcard(rule, rule.APIGroups) || hasURLWildcard(rule) {
+                wildcards.Evidence = append(wildcards.Evidence, grantRole(grant{Role: role})+": "+riskRule(rule))
+                wildcards.Result = "FAIL"
+            }
+        }
     }
-
-    for _, account := range accounts {
-        for _, binding := range account.Bindings {
-            var record []string
-            record = append(record, account.Name, account.Type, binding.Kind, binding.Namespace, binding.RoleRefName, binding.RoleRefKind)
-
-            if flags.MoreOption && len(binding.ExtraRules) > 0 {
-                rule := binding.ExtraRules[0]
-                record = append(record, rule.APIGroups[0], rule.Resources[0], strings.Join(rule.Verbs, ", "))
-                writer.Write(record) 
-
-                // Handling subsequent rules similar to displayProcessedTable
-                for _, rule := range binding.ExtraRules[1:] {
-                    for _, apiGroup := range rule.APIGroups {
-                        for _, resource := range rule.Resources {
-                            writer.Write([]string{"","", "", "", "", "", apiGroup, resource, strings.Join(rule.Verbs, ", ")})
-                        }
-                    }
-                }
-            } else {
-                writer.Write(record)
+    controls = append(controls, wildcards)
+
+    controls = append(controls, grantControl("5.1.4", "Minimize access to create pods", grants, "WARN", func(g grant) bool {
+        return allowsAny(g.Rule, []string{"create"}, "", "pods")
+    }))
+
+    // the automountServiceAccountToken half of 5.1.5 needs the ServiceAccount objects, so without bindings to
+    // default ServiceAccounts it can't pass
+    defaultAccounts := cisControl{ID: "5.1.5", Title: "Ensure that default service accounts are not actively used", Result: "MANUAL"}
+    seen = make(map[string]bool)
+    for _, g := range grants {
+        if g.Subject.Kind == "ServiceAccount" && g.Subject.Name == "default" {
+            evidence := subjectString(g.Subject) + ": " + grantBinding(g) + " -> " + grantRole(g)
+            if !seen[evidence] {
+                seen[evidence] = true
+                defaultAccounts.Evidence = append(defaultAccounts.Evidence, evidence)
+                defaultAccounts.Result = "FAIL"
             }
         }
     }
+    defaultAccounts.Evidence = append(defaultAccounts.Evidence, "check manually that default ServiceAccounts set automountServiceAccountToken: false")
+    controls = append(controls, defaultAccounts)
+
+    controls = append(controls, cisControl{ID: "5.1.6", Title: "Ensure that Service Account Tokens are only mounted where necessary", Result: "MANUAL",
+        Evidence: []string{"needs the pod specs (automountServiceAccountToken), which are not RBAC data"}})
+
+    masters := cisControl{ID: "5.1.7", Title: "Avoid use of system:masters group", Result: "MANUAL",
+        Evidence: []string{"membership comes from client certificates, not from RBAC; review the certificates issued with O=system:masters"}}
+    seen = make(map[string]bool)
+    for _, g := range grants {
+        if g.Subject.Kind == "Group" && g.Subject.Name == "system:masters" && !seen[grantBinding(g)] {
+            seen[grantBinding(g)] = true
+            masters.Evidence = append(masters.Evidence, "bound: "+grantBinding(g)+" -> "+grantRole(g))
+        }
+    }
+    controls = append(controls, masters)
+
+    // binding cluster-admin or impersonating one admin by name is as good as any name
+    controls = append(controls, grantControl("5.1.8", "Limit use of the Bind, Impersonate and Escalate permissions in the Kubernetes cluster", grants, "FAIL", func(g grant) bool {
+        return allowsAny(g.Rule, []string{"bind", "escalate"}, "rbac.authorization.k8s.io", "roles", "clusterroles") ||
+            allowsAny(g.Rule, []string{"impersonate"}, "", "users", "groups", "serviceaccounts")
+    }))
+    controls = append(controls, grantControl("5.1.9", "Minimize access to create persistent volumes", grants, "WARN", func(g grant) bool {
+        return allowsAny(g.Rule, []string{"create"}, "", "persistentvolumes")
+    }))
+    controls = append(controls, grantControl("5.1.10", "Minimize access to the proxy sub-resource of nodes", grants, "WARN", func(g grant) bool {
+        return allowsAny(g.Rule, []string{"get", "create"}, "", "nodes/proxy")
+    }))
+    controls = append(controls, grantControl("5.1.11", "Minimize access to the approval sub-resource of certificatesigningrequests objects", grants, "WARN", func(g grant) bool {
+        return allowsAny(g.Rule, []string{"update", "patch"}, "certificates.k8s.io", "certificatesigningrequests/approval")
+    }))
+    controls = append(controls, grantControl("5.1.12", "Minimize access to webhook configuration objects", grants, "WARN", func(g grant) bool {
+        return allowsAny(g.Rule, writeVerbs, "admissionregistration.k8s.io", "mutatingwebhookconfigurations", "validatingwebhookconfigurations")
+    }))
+    controls = append(controls, grantControl("5.1.13", "Minimize access to the service account token creation", grants, "WARN", func(g grant) bool {
+        return allowsAny(g.Rule, []string{"create"}, "", "serviceaccounts/token")
+    }))
+    return controls
+}
+
+func displayCISControls(controls []cisControl) {
+    counts := make(map[string]int)
+    fmt.Println("CIS Kubernetes Benchmark, section 5.1: RBAC and Service Accounts")
+    fmt.Println("(the default policy of Kubernetes, labeled " + bootstrapLabel + "=rbac-defaults, is not counted;")
+    fmt.Println(" bindings of cluster-admin allow everything and are only listed under 5.1.1)")
+    for _, control := range controls {
+        counts[control.Result]++
+        fmt.Printf("\n[%s] %s %s\n", control.Result, control.ID, control.Title)
+        for _, evidence := range control.Evidence {
+            fmt.Println("       -", evidence)
+        }
+    }
+    fmt.Printf("\n%d passed, %d warned, %d failed, %d manual\n", counts["PASS"], counts["WARN"], counts["FAIL"], counts["MANUAL"])
 }
 
 
 func main() {
-    var refinedWorkspaceRoles	     []Role
-    var refinedGlobalRoles	     []Role
-    var refinedWorkspaceRoleBindings []RoleBinding
-    var refinedGlobalRoleBindings    []RoleBinding
-
     flags := parseInputFlags()
+
+    // Ctrl-C cancels requests that are still running
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
 //    fmt.Println(flags)
 
 //    systemPrefixes := []string{"system:", "kubeadm:", "calico","kubesphere","ks-","ingress-nginx","notification-manager","unity-","vxflexos"}
     systemPrefixes := []string{"system:", "kubeadm:", "kubesphere","ks-","ingress-nginx","notification-manager","unity-","vxflexos"}
-    
 
-
-    refinedRoles, err := storeKubernetesRoles("roles")
-    if err != nil {
-        fmt.Println("Error getting Role data:", err)
-        return
+    if flags.GroupMembers != "" {
+        members, err := loadGroupMembers(flags.GroupMembers)
+        if err != nil {
+            fmt.Println("Error reading group members:", err)
+            os.Exit(1)
+        }
+        GROUPMEMBERS = members
     }
 
-    refinedClusterRoles, err := storeKubernetesRoles("clusterroles")
-    if err != nil {
-        fmt.Println("Error getting Cluster Role data:", err)
+    if flags.CommandType == "snapshot" && flags.ResourceType == "info" {
+        _, metadata, _, err := loadSnapshot(flags.SnapshotPath)
+        if err != nil {
+            fmt.Println("Error reading snapshot:", err)
+            os.Exit(1)
+        }
+        displaySnapshotInfo(metadata)
         return
     }
 
-    refinedClusterBindings, err := storeBindings("clusterrolebindings")
-    if err != nil {
-        fmt.Println("Error getting Cluster Role Binding data:", err)
+    if flags.CommandType == "diff" {
+        if err := runDiff(ctx, flags); err != nil {
+            fmt.Println("Error comparing RBAC data:", err)
+            os.Exit(1)
+        }
         return
     }
 
-    refinedRoleBindings, err := storeBindings("rolebindings")
-    if err != nil {
-        fmt.Println("Error getting Role Binding data:", err)
-        return
+    if isMultiCluster(flags) {
+        if flags.From != "" || flags.Snapshot != "" {
+            fmt.Println("--contexts and --all-contexts read live clusters; they cannot be combined with --from or --snapshot.")
+            os.Exit(1)
+        }
+        if !(flags.CommandType == "show" && flags.ResourceType == "table") && !(flags.CommandType == "get" && (flags.ResourceType == "user" || flags.CSVType == "user")) && flags.CommandType != "lint" {
+            fmt.Println("--contexts and --all-contexts work with 'show' tables, 'get user', 'get csv user' and 'lint'.")
+            os.Exit(1)
+        }
     }
 
-    if flags.KubeSphere {
-	// := 연산자는 새로운 변수를 선언하고 초기화하는데 사용되므로, 기존에 선언된 변수에 값을 할당하기 위해 = 연산자를 사용
-	refinedWorkspaceRoles, err = storeKubernetesRoles("workspaceroles")
-	if err != nil {
-	fmt.Println("Error getting Kubesphere's Workspace Role data:", err)
-        return
-	}
-
-	refinedGlobalRoles, err = storeKubernetesRoles("globalroles")
-	if err != nil {
-	fmt.Println("Error getting Kubesphere's Global Role data:", err)
-        return
-	}
-    
-	refinedWorkspaceRoleBindings, err = storeBindings("workspacerolebindings")
-	if err != nil {
-        fmt.Println("Error getting Workspace Role Binding data:", err)
-        return
-    	}
+    var source *rbacSource
+    var clusters []clusterData
+    var err error
+    if isMultiCluster(flags) {
+        clusters, err = fetchClusters(ctx, flags)
+        if err != nil {
+            fmt.Println("Error", err)
+            os.Exit(1)
+        }
+    } else {
+        source, err = newRBACSource(flags)
+        if err != nil {
+            if flags.From != "" || flags.Snapshot != "" {
+                fmt.Println("Error reading RBAC objects:", err)
+            } else {
+                fmt.Println("Error loading kubeconfig:", err)
+            }
+            os.Exit(1)
+        }
+        if source.snapshot != nil {
+            // stderr, so tables and CSV output stay the same as in live mode
+            fmt.Fprintf(os.Stderr, "# Snapshot of cluster %s (%s), captured at %s\n", source.snapshot.Cluster, source.snapshot.ServerVersion, source.snapshot.CapturedAt)
+        }
 
-	refinedGlobalRoleBindings, err = storeBindings("globalrolebindings")
-	if err != nil {
-        fmt.Println("Error getting Global Role Binding data:", err)
-        return
-	}
+        if flags.CommandType == "snapshot" {
+            if err := saveSnapshot(ctx, source, flags, flags.SnapshotPath); err != nil {
+                fmt.Println("Error saving snapshot:", err)
+                os.Exit(1)
+            }
+            fmt.Println("Snapshot saved to", flags.SnapshotPath)
+            return
+        }
 
+        // fetch only the kinds this command works on, all at once
+        data, err := fetchClusterData(ctx, source, flags)
+        if err != nil {
+            fmt.Println("Error", err)
+            os.Exit(1)
+        }
+        clusters = []clusterData{{Data: data}}
     }
 
+    data := mergeClusterData(clusters)
+    refinedRoles := data.Roles
+    refinedClusterRoles := data.ClusterRoles
+    refinedClusterBindings := data.ClusterRoleBindings
+    refinedRoleBindings := data.RoleBindings
+    refinedWorkspaceRoles := data.WorkspaceRoles
+    refinedGlobalRoles := data.GlobalRoles
+    refinedWorkspaceRoleBindings := data.WorkspaceRoleBindings
+    refinedGlobalRoleBindings := data.GlobalRoleBindings
+
 
  switch flags.CommandType {
 	case "show":
@@ -1107,52 +6047,61 @@ func main() {
 	        default:
 	            displayUsage()
 	        }
-	    case "core":
-	        displayCoreResources()
-	    case "verbs":
-	        displayBuiltInVerbs()
+	    case "core", "verbs":
+	        lists, err := apiResources(ctx, source)
+	        if err != nil {
+	            fmt.Println("Error reading API discovery data:", err)
+	            os.Exit(1)
+	        }
+	        if flags.ResourceType == "core" {
+	            displayCoreResources(lists)
+	        } else {
+	            displayBuiltInVerbs(lists)
+	        }
 	    default:
 	        displayUsage()
 	    }
 	case "get":
 	    switch flags.ResourceType {
 	    case "user":
-		switch {
-		case flags.KubeSphere:
-		    bindingResults, err := processKubeSphereBindings(refinedClusterRoles, refinedRoles, refinedWorkspaceRoles, refinedGlobalRoles, refinedClusterBindings, refinedRoleBindings, refinedWorkspaceRoleBindings, refinedGlobalRoleBindings, flags)
+	        if flags.Overpowered {
+	            reports, err := overpoweredAccounts(clusters, flags)
 	            if err != nil {
-		        fmt.Println("Error processing KubeSphere bindings:", err)
-	                return
-		    }
-
-		    if flags.MoreOption {
-		        bindingResults = attachKubeSphereExtra(bindingResults, refinedClusterRoles, refinedRoles, refinedWorkspaceRoles, refinedGlobalRoles)
-		    }
-	            displayProcessedTable(bindingResults, flags)
-		default:
-	            bindingResults, err := processBindings(refinedClusterRoles, refinedRoles, refinedClusterBindings, refinedRoleBindings, flags)            
-		        if err != nil {
-		            fmt.Println("Error processing bindings:", err)
-	                    return
-		        }
-	            if flags.MoreOption {
-	                bindingResults = attachExtra(bindingResults, refinedClusterRoles, refinedRoles)
+	                fmt.Println("Error", err)
+	                os.Exit(1)
 	            }
-		    // finally, print the data to a display
-	            displayProcessedTable(bindingResults, flags)
-		}
+	            displayRiskReports(reports, flags)
+	            return
+	        }
+	        bindingResults, err := buildUserList(clusters, flags)
+	        if err != nil {
+	            fmt.Println("Error", err)
+	            os.Exit(1)
+	        }
+	        // finally, print the data to a display
+	        displayProcessedTable(bindingResults, flags)
+	    case "orphans":
+	        displayOrphans(findOrphans(data, flags, systemPrefixes, hasServiceAccounts(source)))
 	    case "csv":
 	        switch flags.CSVType {
 	        case "user":
-	            bindingResults, err := processBindings(refinedClusterRoles, refinedRoles, refinedClusterBindings, refinedRoleBindings, flags)
-	            if err != nil {
-	                fmt.Println("Error processing bindings:", err)
+	            if flags.Overpowered {
+	                reports, err := overpoweredAccounts(clusters, flags)
+	                if err != nil {
+	                    fmt.Println("Error", err)
+	                    os.Exit(1)
+	                }
+	                saveRiskReportsCSV(reports, flags)
 	                return
 	            }
-	            if flags.MoreOption {
-	                bindingResults = attachExtra(bindingResults, refinedClusterRoles, refinedRoles)
+	            bindingResults, err := buildUserList(clusters, flags)
+	            if err != nil {
+	                fmt.Println("Error", err)
+	                os.Exit(1)
 	            }
 	            saveAsCSV(bindingResults, flags)
+	        case "orphans":
+	            saveOrphansCSV(findOrphans(data, flags, systemPrefixes, hasServiceAccounts(source)))
 	        case "role":
 	            //saveAsCSV(refinedRoles, flags)
 	        case "rolebinding":
@@ -1167,6 +6116,35 @@ func main() {
 	    default:
 	        displayUsage()
 	    }
+	case "check":
+	    known, err := runCheck(ctx, source, data, flags)
+	    if err != nil {
+	        fmt.Println("Error", err)
+	        os.Exit(1)
+	    }
+	    if !known {
+	        os.Exit(1)
+	    }
+	case "who-can":
+	    if !runWhoCan(ctx, source, data, flags) {
+	        os.Exit(1)
+	    }
+	case "escalation-paths":
+	    if err := runEscalationPaths(data, flags); err != nil {
+	        fmt.Println("Error", err)
+	        os.Exit(1)
+	    }
+	case "lint":
+	    errors, err := runLint(clusters, flags)
+	    if err != nil {
+	        fmt.Println("Error", err)
+	        os.Exit(1)
+	    }
+	    if errors > 0 {
+	        os.Exit(1)
+	    }
+	case "benchmark":
+	    displayCISControls(evaluateCIS(data, flags, systemPrefixes))
 	default:
 	    displayUsage()
 	}
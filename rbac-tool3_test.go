@@ -0,0 +1,1563 @@
+package main
+
+// Run with: go test rbac-tool3.go rbac-tool3_test.go
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "strings"
+    "testing"
+)
+
+
+// ---------------------------------------------------------------------------------------
+// REST client: kubeClient.list against a fake API server
+// ---------------------------------------------------------------------------------------
+
+// an API server that serves pages of a list, checking the credentials and paging parameters of every request
+func fakeListServer(t *testing.T, pages []string, check func(r *http.Request)) *httptest.Server {
+    t.Helper()
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        check(r)
+        page := 0
+        if token := r.URL.Query().Get("continue"); token != "" {
+            fmt.Sscanf(token, "page-%d", &page)
+        }
+        if page >= len(pages) {
+            http.Error(w, "no such page", http.StatusBadRequest)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        fmt.Fprint(w, pages[page])
+    }))
+    t.Cleanup(server.Close)
+    return server
+}
+
+func TestKubeClientListPages(t *testing.T) {
+    pages := []string{
+        `{"kind":"RoleList","metadata":{"continue":"page-1","remainingItemCount":1},"items":[{"metadata":{"name":"a"}},{"metadata":{"name":"b"}}]}`,
+        `{"kind":"RoleList","metadata":{},"items":[{"metadata":{"name":"c"}}]}`,
+    }
+    var continues []string
+    server := fakeListServer(t, pages, func(r *http.Request) {
+        if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+            t.Errorf("Authorization = %q, want the bearer token", got)
+        }
+        if got := r.URL.Query().Get("limit"); got != "2" {
+            t.Errorf("limit = %q, want 2", got)
+        }
+        if r.URL.Path != "/apis/rbac.authorization.k8s.io/v1/roles" {
+            t.Errorf("path = %q", r.URL.Path)
+        }
+        continues = append(continues, r.URL.Query().Get("continue"))
+    })
+
+    client := &kubeClient{Server: server.URL, httpClient: server.Client(), bearerToken: "secret", ChunkSize: 2}
+    var names []string
+    err := client.list(context.Background(), "/apis/rbac.authorization.k8s.io/v1/roles", "roles", func(item json.RawMessage) error {
+        var object namedObject
+        if err := json.Unmarshal(item, &object); err != nil {
+            return err
+        }
+        names = append(names, object.Metadata.Name)
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []string{"a", "b", "c"}; !reflect.DeepEqual(names, want) {
+        t.Errorf("items = %v, want %v", names, want)
+    }
+    if want := []string{"", "page-1"}; !reflect.DeepEqual(continues, want) {
+        t.Errorf("continue tokens = %v, want %v", continues, want)
+    }
+}
+
+func TestKubeClientBasicAuthWithoutPaging(t *testing.T) {
+    server := fakeListServer(t, []string{`{"items":[]}`}, func(r *http.Request) {
+        if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "pw" {
+            t.Errorf("basic auth = %q %q %v", user, password, ok)
+        }
+        if r.URL.RawQuery != "" {
+            t.Errorf("query = %q, want none with ChunkSize 0", r.URL.RawQuery)
+        }
+    })
+    client := &kubeClient{Server: server.URL, httpClient: server.Client(), username: "admin", password: "pw"}
+    if err := client.list(context.Background(), "/api/v1/namespaces", "namespaces", func(json.RawMessage) error { return nil }); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestKubeClientListErrors(t *testing.T) {
+    tests := []struct {
+        name     string
+        status   int
+        body     string
+        notFound bool
+        message  string
+    }{
+        {"not served", http.StatusNotFound, `{"kind":"Status","message":"the server could not find the requested resource"}`, true, "could not find the requested resource"},
+        {"forbidden", http.StatusForbidden, `{"kind":"Status","message":"roles.rbac.authorization.k8s.io is forbidden: User \"bob\" cannot list"}`, false, `User "bob" cannot list`},
+        {"plain text", http.StatusUnauthorized, "Unauthorized\n", false, "Unauthorized"},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.WriteHeader(test.status)
+                fmt.Fprint(w, test.body)
+            }))
+            defer server.Close()
+
+            client := &kubeClient{Server: server.URL, httpClient: server.Client()}
+            err := client.list(context.Background(), "/apis/rbac.authorization.k8s.io/v1/roles", "roles", func(json.RawMessage) error { return nil })
+            apiErr, ok := err.(*apiError)
+            if !ok {
+                t.Fatalf("error = %v, want an *apiError", err)
+            }
+            if apiErr.StatusCode != test.status || !strings.Contains(apiErr.Message, test.message) {
+                t.Errorf("error = %d %q, want %d containing %q", apiErr.StatusCode, apiErr.Message, test.status, test.message)
+            }
+            if isNotFound(err) != test.notFound {
+                t.Errorf("isNotFound = %v, want %v", isNotFound(err), test.notFound)
+            }
+        })
+    }
+}
+
+// a continue token that expired between pages (410 Gone) gets an explanation
+func TestKubeClientListExpiredContinue(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Query().Get("continue") != "" {
+            w.WriteHeader(http.StatusGone)
+            fmt.Fprint(w, `{"kind":"Status","message":"The provided continue parameter is too old"}`)
+            return
+        }
+        fmt.Fprint(w, `{"metadata":{"continue":"next"},"items":[{}]}`)
+    }))
+    defer server.Close()
+
+    client := &kubeClient{Server: server.URL, httpClient: server.Client(), ChunkSize: 1}
+    err := client.list(context.Background(), "/api/v1/serviceaccounts", "serviceaccounts", func(json.RawMessage) error { return nil })
+    if err == nil || !strings.Contains(err.Error(), "changed too much") {
+        t.Errorf("error = %v, want the expired-list explanation", err)
+    }
+}
+
+func TestDecodeListStream(t *testing.T) {
+    tests := []struct {
+        name     string
+        body     string
+        count    int
+        next     string
+        wantErr  bool
+    }{
+        {"items and metadata", `{"metadata":{"continue":"x"},"items":[{"a":1},{"b":2}]}`, 2, "x", false},
+        {"metadata after items", `{"items":[{"a":1}],"metadata":{"continue":"y"}}`, 1, "y", false},
+        {"other fields skipped", `{"kind":"List","apiVersion":"v1","extra":{"items":[1,2,3]},"items":[{}]}`, 1, "", false},
+        {"null items", `{"items":null}`, 0, "", false},
+        {"no items", `{"metadata":{}}`, 0, "", false},
+        {"not an object", `[{"a":1}]`, 0, "", true},
+        {"items not an array", `{"items":{"a":1}}`, 0, "", true},
+        {"truncated", `{"items":[{"a":1},`, 1, "", true},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            var items []string
+            count, metadata, err := decodeListStream(strings.NewReader(test.body), func(item json.RawMessage) error {
+                items = append(items, string(item))
+                return nil
+            })
+            if (err != nil) != test.wantErr {
+                t.Fatalf("error = %v, want error %v", err, test.wantErr)
+            }
+            if count != test.count || len(items) != test.count {
+                t.Errorf("count = %d, visited %d, want %d", count, len(items), test.count)
+            }
+            if metadata.Continue != test.next {
+                t.Errorf("continue = %q, want %q", metadata.Continue, test.next)
+            }
+        })
+    }
+}
+
+// an error of visit stops the stream
+func TestDecodeListStreamVisitError(t *testing.T) {
+    stop := fmt.Errorf("stop")
+    count, _, err := decodeListStream(strings.NewReader(`{"items":[{},{},{}]}`), func(json.RawMessage) error { return stop })
+    if err != stop || count != 1 {
+        t.Errorf("count, error = %d, %v; want 1, stop", count, err)
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// Minimal YAML reader and kubeconfig loader
+// ---------------------------------------------------------------------------------------
+
+func TestParseYAML(t *testing.T) {
+    tests := []struct {
+        name string
+        doc  string
+        want interface{}
+    }{
+        {"block mapping", "a: 1\nb: text\nc: true\nd: ~\n", map[string]interface{}{"a": int64(1), "b": "text", "c": true, "d": nil}},
+        {"nested mapping", "outer:\n  inner:\n    key: value\n", map[string]interface{}{"outer": map[string]interface{}{"inner": map[string]interface{}{"key": "value"}}}},
+        {"sequence of mappings", "clusters:\n- name: a\n  cluster:\n    server: https://a\n- name: b\n", map[string]interface{}{"clusters": []interface{}{
+            map[string]interface{}{"name": "a", "cluster": map[string]interface{}{"server": "https://a"}},
+            map[string]interface{}{"name": "b"},
+        }}},
+        {"indented sequence", "verbs:\n  - get\n  - list\n", map[string]interface{}{"verbs": []interface{}{"get", "list"}}},
+        {"flow collections", "rules: [{apiGroups: [\"\"], resources: [pods, \"*\"], verbs: ['get']}]\n", map[string]interface{}{"rules": []interface{}{
+            map[string]interface{}{"apiGroups": []interface{}{""}, "resources": []interface{}{"pods", "*"}, "verbs": []interface{}{"get"}},
+        }}},
+        {"flow over several lines", "verbs: [get,\n  list]\n", map[string]interface{}{"verbs": []interface{}{"get", "list"}}},
+        {"comments", "# header\na: 1 # trailing\nb: \"x # not a comment\"\nc: 'it''s'\n", map[string]interface{}{"a": int64(1), "b": "x # not a comment", "c": "it's"}},
+        {"colon in value", "server: https://10.0.0.1:6443\n", map[string]interface{}{"server": "https://10.0.0.1:6443"}},
+        {"literal block scalar", "data: |\n  line 1\n  line 2\nnext: x\n", map[string]interface{}{"data": "line 1\nline 2\n", "next": "x"}},
+        {"strip chomping", "data: |-\n  line 1\n\n", map[string]interface{}{"data": "line 1"}},
+        {"keep chomping", "data: |+\n  line 1\n\n", map[string]interface{}{"data": "line 1\n\n"}},
+        {"folded block scalar", "data: >\n  one\n  two\n\n  three\n", map[string]interface{}{"data": "one two\nthree\n"}},
+        {"folded keeps more indented lines", "data: >-\n  one\n    code\n  two\n", map[string]interface{}{"data": "one\n  code\ntwo"}},
+        {"quoted keys and tags", "\"a b\": !!str 123\n", map[string]interface{}{"a b": "123"}},
+        {"anchor without alias", "base: &b value\n", map[string]interface{}{"base": "value"}},
+        {"unquoted wildcards", "resources: [*, */scale]\n", map[string]interface{}{"resources": []interface{}{"*", "*/scale"}}},
+        {"empty document", "# nothing\n\n", nil},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            got, err := parseYAML(test.doc)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, test.want) {
+                t.Errorf("parseYAML = %#v, want %#v", got, test.want)
+            }
+        })
+    }
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        doc  string
+    }{
+        {"alias", "base: &b {a: 1}\ncopy: *b\n"},
+        {"merge key", "base: &b {a: 1}\nother:\n  <<: *b\n"},
+        {"alias in a flow collection", "list: [*b]\n"},
+        {"bad indentation", "a:\n    b: 1\n  c: 2\n"},
+        {"unterminated quote", "a: \"open\n"},
+        {"unclosed flow collection", "a: [1, 2\n"},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if got, err := parseYAML(test.doc); err == nil {
+                t.Errorf("parseYAML = %#v, want an error", got)
+            }
+        })
+    }
+}
+
+func TestParseYAMLDocuments(t *testing.T) {
+    values, err := parseYAMLDocuments([]byte("a: 1\n---\n---\nb: 2\n...\n--- c: 3\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []interface{}{map[string]interface{}{"a": int64(1)}, map[string]interface{}{"b": int64(2)}, map[string]interface{}{"c": int64(3)}}
+    if !reflect.DeepEqual(values, want) {
+        t.Errorf("documents = %#v, want %#v", values, want)
+    }
+}
+
+func writeFile(t *testing.T, path string, content string) {
+    t.Helper()
+    if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// two files in $KUBECONFIG: the first to define a name wins, and relative paths are relative to each file
+func TestLoadKubeConfigMerge(t *testing.T) {
+    dir := t.TempDir()
+    first := filepath.Join(dir, "first")
+    second := filepath.Join(dir, "sub", "second")
+    os.Mkdir(filepath.Join(dir, "sub"), 0700)
+    writeFile(t, first, `
+apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example:6443
+    certificate-authority: ca.crt
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev-user, namespace: team}
+users:
+- name: dev-user
+  user:
+    token: first-token
+`)
+    writeFile(t, second, `
+current-context: prod
+clusters:
+- name: dev
+  cluster: {server: https://shadowed.example}
+- name: prod
+  cluster: {server: https://prod.example}
+contexts:
+- name: prod
+  context: {cluster: prod, user: prod-user}
+users:
+- name: prod-user
+  user:
+    tokenFile: token.txt
+`)
+    t.Setenv("KUBECONFIG", first+string(filepath.ListSeparator)+second)
+
+    config, err := loadKubeConfig("")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if config.CurrentContext != "dev" {
+        t.Errorf("current-context = %q, want the first file's", config.CurrentContext)
+    }
+    if cluster, _ := config.cluster("dev"); cluster.Server != "https://dev.example:6443" || cluster.CertificateAuthority != filepath.Join(dir, "ca.crt") {
+        t.Errorf("cluster dev = %+v", cluster)
+    }
+    if _, ok := config.cluster("prod"); !ok {
+        t.Error("cluster prod of the second file is missing")
+    }
+    if user, _ := config.user("prod-user"); user.TokenFile != filepath.Join(dir, "sub", "token.txt") {
+        t.Errorf("tokenFile = %q, want it next to the second file", user.TokenFile)
+    }
+    if context, _ := config.context("dev"); context.Namespace != "team" || context.User != "dev-user" {
+        t.Errorf("context dev = %+v", context)
+    }
+}
+
+func TestLoadKubeConfigMissing(t *testing.T) {
+    t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "none"))
+    if _, err := loadKubeConfig(""); !os.IsNotExist(err) {
+        t.Errorf("error = %v, want not-exist", err)
+    }
+    if _, err := loadKubeConfig(filepath.Join(t.TempDir(), "explicit")); err == nil {
+        t.Error("a missing explicit kubeconfig must be an error")
+    }
+}
+
+// a client built from a kubeconfig sends its token to the context's server
+func TestNewKubeClientFromKubeConfig(t *testing.T) {
+    server := fakeListServer(t, []string{`{"items":[{"metadata":{"name":"x"}}]}`}, func(r *http.Request) {
+        if got := r.Header.Get("Authorization"); got != "Bearer from-file" {
+            t.Errorf("Authorization = %q", got)
+        }
+    })
+    dir := t.TempDir()
+    writeFile(t, filepath.Join(dir, "token"), "from-file\n")
+    path := filepath.Join(dir, "config")
+    writeFile(t, path, `
+current-context: other
+clusters:
+- name: fake
+  cluster:
+    server: `+server.URL+`/
+contexts:
+- name: fake
+  context:
+    cluster: fake
+    user: fake
+    namespace: apps
+- name: other
+  context: {cluster: missing, user: fake}
+users:
+- name: fake
+  user:
+    tokenFile: token
+`)
+
+    if _, err := newKubeClient(path, ""); err == nil || !strings.Contains(err.Error(), `cluster "missing"`) {
+        t.Errorf("current-context with a missing cluster: error = %v", err)
+    }
+    if _, err := newKubeClient(path, "nope"); err == nil {
+        t.Error("an unknown context must be an error")
+    }
+    client, err := newKubeClient(path, "fake")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if client.Server != server.URL || client.Namespace != "apps" || client.ContextName != "fake" {
+        t.Errorf("client = %+v", client)
+    }
+    count := 0
+    if err := client.list(context.Background(), "/api/v1/namespaces", "namespaces", func(json.RawMessage) error { count++; return nil }); err != nil {
+        t.Fatal(err)
+    }
+    if count != 1 {
+        t.Errorf("items = %d, want 1", count)
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// RBAC objects for the tests below
+// ---------------------------------------------------------------------------------------
+
+func rule(apiGroup string, resource string, verbs ...string) RoleRule {
+    return RoleRule{APIGroups: []string{apiGroup}, Resources: []string{resource}, Verbs: verbs}
+}
+
+func namedRule(apiGroup string, resource string, names []string, verbs ...string) RoleRule {
+    r := rule(apiGroup, resource, verbs...)
+    r.ResourceNames = names
+    return r
+}
+
+func newRole(kind string, namespace string, name string, rules ...RoleRule) Role {
+    return Role{Kind: kind, Metadata: RoleMetadata{Namespace: namespace, Name: name}, Rules: rules}
+}
+
+func newBinding(kind string, namespace string, name string, roleKind string, roleName string, subjects ...BindingSubject) RoleBinding {
+    return RoleBinding{
+        Kind:     kind,
+        Metadata: RoleBindingMeta{Namespace: namespace, Name: name},
+        RoleRef:  BindingRoleRef{Kind: roleKind, Name: roleName},
+        Subjects: subjects,
+    }
+}
+
+func user(name string) BindingSubject {
+    return BindingSubject{Kind: "User", Name: name}
+}
+
+func group(name string) BindingSubject {
+    return BindingSubject{Kind: "Group", Name: name}
+}
+
+func serviceAccount(namespace string, name string) BindingSubject {
+    return BindingSubject{Kind: "ServiceAccount", Namespace: namespace, Name: name}
+}
+
+// the globals filled while bindings are processed start empty in every test
+func resetGlobals(t *testing.T) {
+    t.Helper()
+    USERLIST, GROUPBINDINGS, GROUPMEMBERS = nil, nil, nil
+    t.Cleanup(func() { USERLIST, GROUPBINDINGS, GROUPMEMBERS = nil, nil, nil })
+}
+
+
+// ---------------------------------------------------------------------------------------
+// diff
+// ---------------------------------------------------------------------------------------
+
+func TestDiffObjects(t *testing.T) {
+    before := map[string][]string{"app/kept": {"a"}, "app/changed": {"a", "b"}, "app/removed": {"a"}}
+    after := map[string][]string{"app/kept": {"a"}, "app/changed": {"a", "c"}, "/added": {"a"}}
+
+    changes := make(map[string]objectChange)
+    for _, change := range diffObjects("Role", before, after) {
+        changes[change.Namespace+"/"+change.Name] = change
+    }
+    want := map[string]objectChange{
+        "app/changed": {Change: "modified", Kind: "Role", Namespace: "app", Name: "changed", Details: []string{"+ c", "- b"}},
+        "app/removed": {Change: "removed", Kind: "Role", Namespace: "app", Name: "removed"},
+        "/added":      {Change: "added", Kind: "Role", Namespace: "", Name: "added"},
+    }
+    if !reflect.DeepEqual(changes, want) {
+        t.Errorf("changes = %+v, want %+v", changes, want)
+    }
+}
+
+func TestDiffPermissions(t *testing.T) {
+    resetGlobals(t)
+    before := &rbacData{
+        ClusterRoles: []Role{
+            newRole("ClusterRole", "", "reader", rule("", "pods", "get")),
+            newRole("ClusterRole", "", "all", rule("", "pods", "*")),
+        },
+        ClusterRoleBindings: []RoleBinding{
+            newBinding("ClusterRoleBinding", "", "alice", "ClusterRole", "reader", user("alice")),
+            newBinding("ClusterRoleBinding", "", "carol", "ClusterRole", "all", user("carol")),
+        },
+    }
+    after := &rbacData{
+        ClusterRoles: []Role{
+            newRole("ClusterRole", "", "reader", rule("", "pods", "get", "list")),
+            newRole("ClusterRole", "", "all", rule("", "pods", "*")),
+        },
+        Roles: []Role{newRole("Role", "app", "deployer", rule("apps", "deployments", "create"))},
+        ClusterRoleBindings: []RoleBinding{
+            newBinding("ClusterRoleBinding", "", "alice", "ClusterRole", "reader", user("alice")),
+            newBinding("ClusterRoleBinding", "", "carol", "ClusterRole", "all", user("carol")),
+            newBinding("ClusterRoleBinding", "", "carol-reader", "ClusterRole", "reader", user("carol")),
+        },
+        RoleBindings: []RoleBinding{newBinding("RoleBinding", "app", "deployer", "Role", "deployer", serviceAccount("app", "ci"))},
+    }
+
+    // carol's new get and list are covered by the "*" she already had
+    want := []permissionChange{
+        {permissionKey{"alice", "User", "*", "", "pods"}, []string{"list"}, nil},
+        {permissionKey{"app/ci", "ServiceAccount", "app", "apps", "deployments"}, []string{"create"}, nil},
+    }
+    if got := diffPermissions(before, after); !reflect.DeepEqual(got, want) {
+        t.Errorf("diffPermissions = %+v, want %+v", got, want)
+    }
+    if got := diffPermissions(after, before); len(got) != 2 || got[0].Lost[0] != "list" || got[1].Lost[0] != "create" {
+        t.Errorf("reversed diffPermissions = %+v, want the same changes as lost", got)
+    }
+}
+
+// changes to KubeSphere roles and bindings show up per subject, in the workspace of the binding
+func TestDiffPermissionsKubeSphere(t *testing.T) {
+    resetGlobals(t)
+    workspaceBinding := newBinding("WorkspaceRoleBinding", "", "bob-ws1", "WorkspaceRole", "ws1-viewer", user("bob"))
+    workspaceBinding.Metadata.Labels = map[string]string{"kubesphere.io/workspace": "ws1"}
+    data := func(viewer Role) *rbacData {
+        return &rbacData{
+            WorkspaceRoles:        []Role{viewer},
+            GlobalRoles:           []Role{newRole("GlobalRole", "", "platform-regular", rule("iam.kubesphere.io", "users", "get"))},
+            WorkspaceRoleBindings: []RoleBinding{workspaceBinding},
+            GlobalRoleBindings:    []RoleBinding{newBinding("GlobalRoleBinding", "", "dave", "GlobalRole", "platform-regular", user("dave"))},
+        }
+    }
+    before := data(newRole("WorkspaceRole", "", "ws1-viewer", rule("", "pods", "get")))
+    after := data(newRole("WorkspaceRole", "", "ws1-viewer", rule("", "pods", "get"), rule("", "secrets", "get")))
+
+    want := []permissionChange{{permissionKey{"bob", "User", "ws1", "", "secrets"}, []string{"get"}, nil}}
+    if got := diffPermissions(before, after); !reflect.DeepEqual(got, want) {
+        t.Errorf("diffPermissions = %+v, want %+v", got, want)
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// ClusterRole aggregation
+// ---------------------------------------------------------------------------------------
+
+func TestLabelSelectorMatches(t *testing.T) {
+    labels := map[string]string{"tier": "web", "env": "prod"}
+    tests := []struct {
+        name     string
+        selector LabelSelector
+        want     bool
+    }{
+        {"empty", LabelSelector{}, true},
+        {"matchLabels", LabelSelector{MatchLabels: map[string]string{"tier": "web"}}, true},
+        {"matchLabels other value", LabelSelector{MatchLabels: map[string]string{"tier": "db"}}, false},
+        {"In", LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "env", Operator: "In", Values: []string{"dev", "prod"}}}}, true},
+        {"NotIn", LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "env", Operator: "NotIn", Values: []string{"prod"}}}}, false},
+        {"NotIn missing key", LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "team", Operator: "NotIn", Values: []string{"a"}}}}, true},
+        {"Exists", LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "env", Operator: "Exists"}}}, true},
+        {"DoesNotExist", LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "env", Operator: "DoesNotExist"}}}, false},
+        {"unknown operator", LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "env", Operator: "Gt"}}}, false},
+    }
+    for _, test := range tests {
+        if got := test.selector.matches(labels); got != test.want {
+            t.Errorf("%s: matches = %v, want %v", test.name, got, test.want)
+        }
+    }
+}
+
+func aggregatingRole(name string, label string, selects string, rules ...RoleRule) Role {
+    role := newRole("ClusterRole", "", name, rules...)
+    if label != "" {
+        role.Metadata.Labels = map[string]string{label: "true"}
+    }
+    if selects != "" {
+        role.AggregationRule = &AggregationRule{ClusterRoleSelectors: []LabelSelector{{MatchLabels: map[string]string{selects: "true"}}}}
+    }
+    return role
+}
+
+func ruleResources(rules []RoleRule) []string {
+    var resources []string
+    for _, r := range rules {
+        resources = append(resources, r.Resources...)
+    }
+    return resources
+}
+
+// view -> edit -> admin: an aggregate gets the rules its contributors aggregated, whatever their order
+func TestAggregateClusterRolesNested(t *testing.T) {
+    roles := []Role{
+        aggregatingRole("admin", "", "aggregate-to-admin", rule("", "stored", "get")),
+        aggregatingRole("edit", "aggregate-to-admin", "aggregate-to-edit"),
+        aggregatingRole("view", "aggregate-to-edit", "aggregate-to-view"),
+        aggregatingRole("pods-reader", "aggregate-to-view", "", rule("", "pods", "get")),
+        aggregatingRole("deployer", "aggregate-to-edit", "", rule("apps", "deployments", "create")),
+        aggregatingRole("unrelated", "other", "", rule("", "secrets", "get")),
+    }
+    aggregateClusterRoles(roles)
+
+    want := map[string][]string{
+        "admin": {"stored", "deployments", "pods"},
+        "edit":  {"deployments", "pods"},
+        "view":  {"pods"},
+    }
+    for _, role := range roles[:3] {
+        if got := ruleResources(role.Rules); !reflect.DeepEqual(got, want[role.Metadata.Name]) {
+            t.Errorf("%s rules = %v, want %v", role.Metadata.Name, got, want[role.Metadata.Name])
+        }
+    }
+    if got := roles[1].AggregatedFrom; !reflect.DeepEqual(got, []string{"deployer", "view"}) {
+        t.Errorf("edit AggregatedFrom = %v", got)
+    }
+}
+
+// aggregates that select each other terminate, and (once merged, as storeKubernetesRoles does) both hold both rules
+func TestAggregateClusterRolesCycle(t *testing.T) {
+    roles := []Role{
+        aggregatingRole("a", "to-b", "to-a", rule("", "pods", "get")),
+        aggregatingRole("b", "to-a", "to-b", rule("", "secrets", "get")),
+    }
+    aggregateClusterRoles(roles)
+
+    for _, role := range roles {
+        if got := ruleResources(mergeRules(role.Rules)); !reflect.DeepEqual(got, []string{"pods", "secrets"}) {
+            t.Errorf("%s rules = %v, want pods and secrets", role.Metadata.Name, got)
+        }
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// Merging rules
+// ---------------------------------------------------------------------------------------
+
+func TestMergeRules(t *testing.T) {
+    tests := []struct {
+        name  string
+        rules []RoleRule
+        want  []RoleRule
+    }{
+        {
+            "verbs of one resource",
+            []RoleRule{rule("", "pods", "list"), rule("", "pods", "get", "list")},
+            []RoleRule{{APIGroups: []string{""}, Resources: []string{"pods"}, ResourceNames: []string{}, Verbs: []string{"get", "list"}}},
+        },
+        {
+            "one rule per group and resource",
+            []RoleRule{{APIGroups: []string{"", "apps"}, Resources: []string{"pods", "deployments"}, Verbs: []string{"get"}}},
+            []RoleRule{
+                {APIGroups: []string{""}, Resources: []string{"deployments"}, ResourceNames: []string{}, Verbs: []string{"get"}},
+                {APIGroups: []string{""}, Resources: []string{"pods"}, ResourceNames: []string{}, Verbs: []string{"get"}},
+                {APIGroups: []string{"apps"}, Resources: []string{"deployments"}, ResourceNames: []string{}, Verbs: []string{"get"}},
+                {APIGroups: []string{"apps"}, Resources: []string{"pods"}, ResourceNames: []string{}, Verbs: []string{"get"}},
+            },
+        },
+        {
+            "resourceNames kept apart",
+            []RoleRule{
+                rule("", "secrets", "list"),
+                namedRule("", "secrets", []string{"b", "a"}, "get"),
+                namedRule("", "secrets", []string{"a", "b"}, "update"),
+                namedRule("", "secrets", []string{"c"}, "get"),
+            },
+            []RoleRule{
+                {APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{}, Verbs: []string{"list"}},
+                {APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"a", "b"}, Verbs: []string{"get", "update"}},
+                {APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"c"}, Verbs: []string{"get"}},
+            },
+        },
+        {
+            "non-resource URLs after resources",
+            []RoleRule{
+                {NonResourceURLs: []string{"/metrics", "/healthz"}, Verbs: []string{"get"}},
+                {NonResourceURLs: []string{"/metrics"}, Verbs: []string{"post"}},
+                rule("", "nodes", "get"),
+            },
+            []RoleRule{
+                {APIGroups: []string{""}, Resources: []string{"nodes"}, ResourceNames: []string{}, Verbs: []string{"get"}},
+                {NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}},
+                {NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get", "post"}},
+            },
+        },
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            got := mergeRules(test.rules)
+            sort.Stable(SortByAPIGroup(got))
+            if !reflect.DeepEqual(got, test.want) {
+                t.Errorf("mergeRules = %+v, want %+v", got, test.want)
+            }
+        })
+    }
+}
+
+func TestSortedVerbs(t *testing.T) {
+    set := func(verbs ...string) map[string]struct{} {
+        m := make(map[string]struct{})
+        for _, verb := range verbs {
+            m[verb] = struct{}{}
+        }
+        return m
+    }
+    tests := []struct {
+        verbs []string
+        want  []string
+    }{
+        {[]string{"list", "get", "bind", "watch"}, []string{"get", "list", "watch", "bind"}},
+        {[]string{"get", "*", "list"}, []string{"*"}},
+        {[]string{"zz-custom", "get", "aa-custom"}, []string{"get", "aa-custom", "zz-custom"}},
+        {verbOrder, verbOrder},
+    }
+    for _, test := range tests {
+        if got := sortedVerbs(set(test.verbs...)); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("sortedVerbs(%v) = %v, want %v", test.verbs, got, test.want)
+        }
+    }
+}
+
+// wildcards are spelled out so they can't be read as a literal group, resource or verb
+func TestRuleCells(t *testing.T) {
+    tests := []struct {
+        rule  RoleRule
+        cells [][2]string
+        verbs string
+    }{
+        {rule("", "pods", "get", "bind"), [][2]string{{"", "pods"}}, "get, bind(!)"},
+        {rule("*", "*", "*"), [][2]string{{"* (all API groups)", "* (all resources)"}}, "* (all verbs)"},
+        {rule("apps", "*/scale", "update"), [][2]string{{"apps", "*/scale (all resources)"}}, "update"},
+        {namedRule("", "secrets", []string{"a", "b"}, "get"), [][2]string{{"", "secrets (only: a, b)"}}, "get"},
+        {RoleRule{NonResourceURLs: []string{"/metrics", "/logs/*"}, Verbs: []string{"get"}}, [][2]string{{"(non-resource)", "/metrics"}, {"(non-resource)", "/logs/* (!wildcard)"}}, "get"},
+    }
+    for _, test := range tests {
+        if got := ruleCells(test.rule); !reflect.DeepEqual(got, test.cells) {
+            t.Errorf("ruleCells(%+v) = %v, want %v", test.rule, got, test.cells)
+        }
+        if got := verbsCell(test.rule.Verbs); got != test.verbs {
+            t.Errorf("verbsCell(%v) = %q, want %q", test.rule.Verbs, got, test.verbs)
+        }
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// Implicit groups
+// ---------------------------------------------------------------------------------------
+
+func TestImplicitGroups(t *testing.T) {
+    tests := []struct {
+        kind, name, namespace string
+        want                  []string
+    }{
+        {"User", "alice", "", []string{"system:authenticated"}},
+        {"User", "system:anonymous", "", []string{"system:unauthenticated"}},
+        {"ServiceAccount", "ci", "app", []string{"system:authenticated", "system:serviceaccounts", "system:serviceaccounts:app"}},
+        {"Group", "devs", "", nil},
+    }
+    for _, test := range tests {
+        if got := implicitGroups(test.kind, test.name, test.namespace); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("implicitGroups(%s %s) = %v, want %v", test.kind, test.name, got, test.want)
+        }
+    }
+}
+
+// the groups of each account's implicit bindings, in order
+func implicitBindings(accounts []AccountInfo) map[string][]string {
+    result := make(map[string][]string)
+    for _, account := range accounts {
+        for _, binding := range account.Bindings {
+            if binding.Implicit {
+                result[accountName(account)] = append(result[accountName(account)], binding.ViaGroup)
+            }
+        }
+    }
+    return result
+}
+
+// ServiceAccounts always get the bindings of their implicit groups, Users only with --implicit
+func TestAddImplicitGroups(t *testing.T) {
+    resetGlobals(t)
+    bindings := []RoleBinding{
+        newBinding("ClusterRoleBinding", "", "discovery", "ClusterRole", "system:discovery", group("system:authenticated")),
+        newBinding("ClusterRoleBinding", "", "public", "ClusterRole", "system:public-info-viewer", group("system:unauthenticated")),
+        newBinding("ClusterRoleBinding", "", "sa-view", "ClusterRole", "view", group("system:serviceaccounts:app")),
+        newBinding("ClusterRoleBinding", "", "alice", "ClusterRole", "view", user("alice"), user("system:anonymous")),
+    }
+    roleBindings := []RoleBinding{newBinding("RoleBinding", "app", "ci", "Role", "ci", serviceAccount("", "ci"))}
+
+    tests := []struct {
+        implicit bool
+        want     map[string][]string
+    }{
+        {false, map[string][]string{"app/ci": {"system:authenticated", "system:serviceaccounts:app"}}},
+        {true, map[string][]string{
+            "alice":            {"system:authenticated"},
+            "system:anonymous": {"system:unauthenticated"},
+            "app/ci":           {"system:authenticated", "system:serviceaccounts:app"},
+        }},
+    }
+    for _, test := range tests {
+        accounts, err := processBindings(nil, nil, bindings, roleBindings, InputFlags{Service: true, Implicit: test.implicit})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got := implicitBindings(accounts); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("--implicit=%v: implicit bindings = %v, want %v", test.implicit, got, test.want)
+        }
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// Account identity
+// ---------------------------------------------------------------------------------------
+
+func accountKeys(accounts []AccountInfo) []string {
+    var keys []string
+    for _, account := range accounts {
+        keys = append(keys, fmt.Sprintf("%s %s (%d)", account.Type, accountName(account), len(account.Bindings)))
+    }
+    return keys
+}
+
+// accounts are told apart by kind, namespace and name, and sorted by that key
+func TestAccountIdentity(t *testing.T) {
+    resetGlobals(t)
+    USERLIST = []AccountInfo{}
+    info := BindingInfo{Kind: "RoleBinding", RoleRefKind: "ClusterRole", RoleRefName: "view"}
+    addToTable("default", "ServiceAccount", "web", info)
+    addToTable("ops", "User", "", info)
+    addToTable("default", "ServiceAccount", "app", info)
+    addToTable("ops", "Group", "", info)
+    addToTable("default", "ServiceAccount", "web", info)
+    addToTable("admin", "User", "", info)
+    sortTable()
+
+    want := []string{"Group ops (1)", "ServiceAccount app/default (1)", "ServiceAccount web/default (2)", "User admin (1)", "User ops (1)"}
+    if got := accountKeys(USERLIST); !reflect.DeepEqual(got, want) {
+        t.Errorf("accounts = %v, want %v", got, want)
+    }
+}
+
+func TestMergeAccounts(t *testing.T) {
+    resetGlobals(t)
+    binding := func(name string) []BindingInfo { return []BindingInfo{{RoleRefName: name}} }
+    USERLIST = []AccountInfo{
+        {Name: "default", Type: "ServiceAccount", Namespace: "app", Bindings: binding("a")},
+        {Name: "default", Type: "ServiceAccount", Namespace: "web", Bindings: binding("b")},
+        {Name: "default", Type: "ServiceAccount", Namespace: "app", Bindings: binding("c")},
+        {Name: "default", Type: "User", Bindings: binding("d")},
+        {Name: "default", Type: "ServiceAccount", Namespace: "app", Bindings: binding("e")},
+    }
+    mergeAccounts()
+
+    want := []string{"ServiceAccount app/default (3)", "ServiceAccount web/default (1)", "User default (1)"}
+    if got := accountKeys(USERLIST); !reflect.DeepEqual(got, want) {
+        t.Errorf("accounts = %v, want %v", got, want)
+    }
+    var merged []string
+    for _, info := range USERLIST[0].Bindings {
+        merged = append(merged, info.RoleRefName)
+    }
+    if !reflect.DeepEqual(merged, []string{"a", "c", "e"}) {
+        t.Errorf("merged bindings = %v, want a, c, e", merged)
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// check
+// ---------------------------------------------------------------------------------------
+
+func TestRuleAllows(t *testing.T) {
+    get := func(apiGroup string, resource string) accessRequest {
+        return accessRequest{Verb: "get", APIGroup: apiGroup, Resource: resource}
+    }
+    named := get("", "secrets")
+    named.Name = "db"
+    anyName := get("", "secrets")
+    anyName.AnyName = true
+    tests := []struct {
+        name    string
+        rule    RoleRule
+        request accessRequest
+        want    bool
+    }{
+        {"exact", rule("", "pods", "get"), get("", "pods"), true},
+        {"other verb", rule("", "pods", "list"), get("", "pods"), false},
+        {"wildcard verb", rule("", "pods", "*"), get("", "pods"), true},
+        {"other group", rule("", "deployments", "get"), get("apps", "deployments"), false},
+        {"wildcard group", rule("*", "deployments", "get"), get("apps", "deployments"), true},
+        {"wildcard resource", rule("apps", "*", "get"), get("apps", "deployments/scale"), true},
+        {"subresource not the resource", rule("", "pods", "get"), get("", "pods/log"), false},
+        {"wildcard subresource", rule("apps", "*/scale", "get"), get("apps", "deployments/scale"), true},
+        {"wildcard subresource not the resource", rule("apps", "*/scale", "get"), get("apps", "deployments"), false},
+        {"resourceNames without a name", namedRule("", "secrets", []string{"db"}, "get"), get("", "secrets"), false},
+        {"resourceNames with the name", namedRule("", "secrets", []string{"web", "db"}, "get"), named, true},
+        {"resourceNames with another name", namedRule("", "secrets", []string{"web"}, "get"), named, false},
+        {"resourceNames with any name", namedRule("", "secrets", []string{"web"}, "get"), anyName, true},
+        {"URL", RoleRule{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}, accessRequest{Verb: "get", URL: "/metrics"}, true},
+        {"URL prefix", RoleRule{NonResourceURLs: []string{"/logs/*"}, Verbs: []string{"get"}}, accessRequest{Verb: "get", URL: "/logs/kube.log"}, true},
+        {"other URL", RoleRule{NonResourceURLs: []string{"/logs/*"}, Verbs: []string{"get"}}, accessRequest{Verb: "get", URL: "/metrics"}, false},
+        {"URL against a resource rule", rule("*", "*", "*"), accessRequest{Verb: "get", URL: "/metrics"}, false},
+    }
+    for _, test := range tests {
+        if got := ruleAllows(test.rule, test.request); got != test.want {
+            t.Errorf("%s: ruleAllows = %v, want %v", test.name, got, test.want)
+        }
+    }
+}
+
+func TestNewAccessRequest(t *testing.T) {
+    ctx := context.Background()
+    offline := &rbacSource{objects: map[string][]json.RawMessage{}}
+    discovered := &rbacSource{objects: offline.objects, discovery: []APIResourceList{
+        {GroupVersion: "v1", Resources: []APIResource{{Name: "pods"}}},
+        {GroupVersion: "apps/v1", Resources: []APIResource{{Name: "deployments"}}},
+    }}
+    tests := []struct {
+        source *rbacSource
+        target string
+        want   accessRequest
+    }{
+        {offline, "deployments", accessRequest{Verb: "get", Resource: "deployments", GroupGuessed: true}},
+        {offline, "deployments.apps/scale", accessRequest{Verb: "get", APIGroup: "apps", Resource: "deployments/scale"}},
+        {offline, "/healthz", accessRequest{Verb: "get", URL: "/healthz"}},
+        {discovered, "deployments", accessRequest{Verb: "get", APIGroup: "apps", Resource: "deployments"}},
+        {discovered, "pods/log", accessRequest{Verb: "get", Resource: "pods/log"}},
+        {discovered, "widgets", accessRequest{Verb: "get", Resource: "widgets", GroupGuessed: true}},
+    }
+    for _, test := range tests {
+        if got := newAccessRequest(ctx, test.source, "get", test.target, "", ""); got != test.want {
+            t.Errorf("newAccessRequest(%q) = %+v, want %+v", test.target, got, test.want)
+        }
+    }
+}
+
+// a guessed core group is only trusted when no rule names the resource in another group
+func TestAmbiguousGroups(t *testing.T) {
+    data := &rbacData{
+        ClusterRoles: []Role{newRole("ClusterRole", "", "edit", rule("apps", "deployments", "get"), rule("*", "deployments", "list"))},
+        Roles:        []Role{newRole("Role", "app", "old", rule("extensions", "deployments", "get"), rule("", "pods", "get"))},
+    }
+    tests := []struct {
+        request accessRequest
+        want    []string
+    }{
+        {accessRequest{Verb: "get", Resource: "deployments", GroupGuessed: true}, []string{"apps", "extensions"}},
+        {accessRequest{Verb: "get", Resource: "deployments", APIGroup: "apps"}, nil},
+        {accessRequest{Verb: "get", Resource: "pods", GroupGuessed: true}, nil},
+    }
+    for _, test := range tests {
+        if got := ambiguousGroups(data, test.request); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("ambiguousGroups(%s) = %v, want %v", test.request, got, test.want)
+        }
+    }
+}
+
+func TestFindGrants(t *testing.T) {
+    data := &rbacData{
+        ClusterRoles: []Role{
+            newRole("ClusterRole", "", "reader", rule("", "pods", "get")),
+            newRole("ClusterRole", "", "metrics", RoleRule{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}),
+        },
+        Roles: []Role{
+            newRole("Role", "app", "reader", rule("", "pods", "get")),
+            newRole("Role", "web", "reader", rule("", "pods", "list")),
+        },
+        ClusterRoleBindings: []RoleBinding{
+            newBinding("ClusterRoleBinding", "", "global", "ClusterRole", "reader", user("alice"), group("ops")),
+            newBinding("ClusterRoleBinding", "", "metrics", "ClusterRole", "metrics", user("prom")),
+            newBinding("ClusterRoleBinding", "", "dangling", "ClusterRole", "missing", user("eve")),
+        },
+        RoleBindings: []RoleBinding{
+            newBinding("RoleBinding", "app", "local", "Role", "reader", user("bob")),
+            newBinding("RoleBinding", "app", "cluster-role", "ClusterRole", "reader", user("carol")),
+            // the Role of the same name in web does not apply to a binding in app
+            newBinding("RoleBinding", "web", "local", "Role", "reader", user("dave")),
+        },
+    }
+    subjects := func(grants []grant) []string {
+        var names []string
+        for _, g := range grants {
+            names = append(names, g.Subject.Name)
+        }
+        return names
+    }
+    tests := []struct {
+        request accessRequest
+        want    []string
+    }{
+        {accessRequest{Verb: "get", Resource: "pods"}, []string{"alice", "ops"}},
+        {accessRequest{Verb: "get", Resource: "pods", Namespace: "app"}, []string{"alice", "ops", "bob", "carol"}},
+        {accessRequest{Verb: "get", Resource: "pods", Namespace: "web"}, []string{"alice", "ops"}},
+        {accessRequest{Verb: "get", Resource: "pods", AllNamespaces: true}, []string{"alice", "ops", "bob", "carol"}},
+        {accessRequest{Verb: "get", URL: "/metrics", AllNamespaces: true}, []string{"prom"}},
+    }
+    for _, test := range tests {
+        if got := subjects(findGrants(data, test.request)); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("findGrants(%s) = %v, want %v", test.request, got, test.want)
+        }
+    }
+}
+
+func TestParseSubject(t *testing.T) {
+    tests := []struct {
+        text    string
+        want    BindingSubject
+        wantErr bool
+    }{
+        {"alice", user("alice"), false},
+        {"User:system:admin", user("system:admin"), false},
+        {"Group:devs", group("devs"), false},
+        {"ServiceAccount:app/ci", serviceAccount("app", "ci"), false},
+        {"system:serviceaccount:app:ci", serviceAccount("app", "ci"), false},
+        {"User:system:serviceaccount:app:ci", serviceAccount("app", "ci"), false},
+        {"ServiceAccount:ci", BindingSubject{}, true},
+        {"system:serviceaccount:ci", BindingSubject{}, true},
+    }
+    for _, test := range tests {
+        got, err := parseSubject(test.text)
+        if (err != nil) != test.wantErr || got != test.want {
+            t.Errorf("parseSubject(%q) = %+v, %v; want %+v, error %v", test.text, got, err, test.want, test.wantErr)
+        }
+    }
+}
+
+func TestSubjectMatches(t *testing.T) {
+    binding := newBinding("RoleBinding", "app", "b", "Role", "r")
+    ci := serviceAccount("app", "ci")
+    ciGroups := implicitGroups("ServiceAccount", "ci", "app")
+    tests := []struct {
+        name    string
+        bound   BindingSubject
+        subject BindingSubject
+        groups  []string
+        want    bool
+        via     string
+    }{
+        {"same user", user("alice"), user("alice"), nil, true, ""},
+        {"user and group of one name", group("alice"), user("alice"), nil, false, ""},
+        {"group queried directly", group("devs"), group("devs"), nil, true, ""},
+        {"member of the group", group("devs"), user("alice"), []string{"devs"}, true, "devs"},
+        {"ServiceAccount", ci, ci, ciGroups, true, ""},
+        {"ServiceAccount in the binding's namespace", BindingSubject{Kind: "ServiceAccount", Name: "ci"}, ci, ciGroups, true, ""},
+        {"ServiceAccount of another namespace", serviceAccount("web", "ci"), ci, ciGroups, false, ""},
+        {"ServiceAccount as a User subject", user("system:serviceaccount:app:ci"), ci, ciGroups, true, ""},
+        {"ServiceAccount through its namespace group", group("system:serviceaccounts:app"), ci, ciGroups, true, "system:serviceaccounts:app"},
+    }
+    for _, test := range tests {
+        matched, via := subjectMatches(test.bound, binding, test.subject, test.groups)
+        if matched != test.want || via != test.via {
+            t.Errorf("%s: subjectMatches = %v, %q; want %v, %q", test.name, matched, via, test.want, test.via)
+        }
+    }
+}
+
+// offline, a bare resource that rules name in other groups gets no answer instead of a guess
+func TestRunCheckAmbiguous(t *testing.T) {
+    resetGlobals(t)
+    data := &rbacData{
+        ClusterRoles:        []Role{newRole("ClusterRole", "", "deployer", rule("apps", "deployments", "get"))},
+        ClusterRoleBindings: []RoleBinding{newBinding("ClusterRoleBinding", "", "alice", "ClusterRole", "deployer", user("alice"))},
+    }
+    source := &rbacSource{objects: map[string][]json.RawMessage{}}
+    for _, test := range []struct {
+        target string
+        known  bool
+    }{{"deployments", false}, {"deployments.apps", true}, {"pods", true}} {
+        known, err := runCheck(context.Background(), source, data, InputFlags{CheckArgs: []string{"alice", "get", test.target}})
+        if err != nil || known != test.known {
+            t.Errorf("check %s: known = %v, %v; want %v", test.target, known, err, test.known)
+        }
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// who-can
+// ---------------------------------------------------------------------------------------
+
+// returns what run prints to standard output
+func captureStdout(t *testing.T, run func()) string {
+    t.Helper()
+    reader, writer, err := os.Pipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    stdout := os.Stdout
+    os.Stdout = writer
+    defer func() { os.Stdout = stdout }()
+
+    output := make(chan string)
+    go func() {
+        var b strings.Builder
+        buffer := make([]byte, 4096)
+        for {
+            n, err := reader.Read(buffer)
+            b.Write(buffer[:n])
+            if err != nil {
+                break
+            }
+        }
+        output <- b.String()
+    }()
+    run()
+    writer.Close()
+    return <-output
+}
+
+// the Subject, Namespace and Names cells of each row of the who-can table
+func whoCanRows(output string) []string {
+    var rows []string
+    for _, line := range strings.Split(output, "\n") {
+        cells := strings.Split(line, "|")
+        if len(cells) < 3 || strings.HasPrefix(cells[0], "Subject") || strings.HasPrefix(cells[0], "---") {
+            continue
+        }
+        rows = append(rows, strings.TrimSpace(cells[0])+" | "+strings.TrimSpace(cells[1])+" | "+strings.TrimSpace(cells[2]))
+    }
+    return rows
+}
+
+func TestRunWhoCan(t *testing.T) {
+    resetGlobals(t)
+    GROUPMEMBERS = map[string][]string{"ops": {"olga"}}
+    data := &rbacData{
+        ClusterRoles: []Role{
+            newRole("ClusterRole", "", "admin", rule("*", "*", "*")),
+            newRole("ClusterRole", "", "deployer", rule("apps", "deployments", "get")),
+        },
+        Roles: []Role{newRole("Role", "app", "db", namedRule("", "secrets", []string{"db-password"}, "get"))},
+        ClusterRoleBindings: []RoleBinding{
+            newBinding("ClusterRoleBinding", "", "admin", "ClusterRole", "admin", group("ops")),
+            newBinding("ClusterRoleBinding", "", "deployer", "ClusterRole", "deployer", user("alice")),
+        },
+        RoleBindings: []RoleBinding{newBinding("RoleBinding", "app", "db", "Role", "db", user("dan"), BindingSubject{Kind: "ServiceAccount", Name: "api"})},
+    }
+    source := &rbacSource{objects: map[string][]json.RawMessage{}}
+    tests := []struct {
+        args  []string
+        name  string
+        known bool
+        want  []string
+    }{
+        {[]string{"get", "secrets"}, "", true, []string{
+            "Group ops | * | *",
+            "ServiceAccount app/api | app | db-password",
+            "User dan | app | db-password",
+            "User olga (group ops) | * | *",
+        }},
+        {[]string{"get", "secrets"}, "db-password", true, []string{
+            "Group ops | * | db-password",
+            "ServiceAccount app/api | app | db-password",
+            "User dan | app | db-password",
+            "User olga (group ops) | * | db-password",
+        }},
+        {[]string{"get", "secrets"}, "tls", true, []string{"Group ops | * | tls", "User olga (group ops) | * | tls"}},
+        {[]string{"get", "deployments"}, "", false, nil},
+        {[]string{"get", "deployments.apps"}, "", true, []string{"Group ops | * | *", "User alice | * | *", "User olga (group ops) | * | *"}},
+    }
+    for _, test := range tests {
+        var known bool
+        output := captureStdout(t, func() {
+            known = runWhoCan(context.Background(), source, data, InputFlags{CheckArgs: test.args, ObjectName: test.name})
+        })
+        if known != test.known {
+            t.Errorf("who-can %v --name %q: known = %v, want %v", test.args, test.name, known, test.known)
+        }
+        if got := whoCanRows(output); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("who-can %v --name %q: rows = %q, want %q", test.args, test.name, got, test.want)
+        }
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// --overpowered
+// ---------------------------------------------------------------------------------------
+
+func clusterBinding(roleName string, rules ...RoleRule) BindingInfo {
+    return BindingInfo{Kind: "ClusterRoleBinding", RoleRefKind: "ClusterRole", RoleRefName: roleName, ExtraRules: rules}
+}
+
+func namespaceBinding(namespace string, roleName string, rules ...RoleRule) BindingInfo {
+    return BindingInfo{Kind: "RoleBinding", Namespace: namespace, RoleRefKind: "ClusterRole", RoleRefName: roleName, ExtraRules: rules}
+}
+
+func TestAssessAccounts(t *testing.T) {
+    accounts := []AccountInfo{
+        {Name: "reader", Type: "User", Bindings: []BindingInfo{clusterBinding("view", rule("", "pods", "get", "list"))}},
+        {Name: "dan", Type: "User", Bindings: []BindingInfo{namespaceBinding("app", "db", namedRule("", "secrets", []string{"db-password"}, "get"))}},
+        {Name: "bob", Type: "User", Bindings: []BindingInfo{clusterBinding("binder",
+            namedRule("rbac.authorization.k8s.io", "clusterroles", []string{"cluster-admin"}, "bind"),
+            rule("rbac.authorization.k8s.io", "clusterrolebindings", "create"),
+        )}},
+        {Name: "root", Type: "User", Bindings: []BindingInfo{clusterBinding("cluster-admin", rule("*", "*", "*"), RoleRule{NonResourceURLs: []string{"*"}, Verbs: []string{"*"}})}},
+        {Name: "ns-admin", Type: "User", Bindings: []BindingInfo{namespaceBinding("web", "admin", rule("*", "*", "*"))}},
+        {Name: "kubelet-reader", Type: "User", Bindings: []BindingInfo{
+            namespaceBinding("web", "proxy", rule("", "nodes/proxy", "get")),
+            clusterBinding("proxy", rule("", "nodes/proxy", "get")),
+        }},
+        {Name: "named-admin", Type: "User", Bindings: []BindingInfo{clusterBinding("odd", namedRule("*", "*", []string{"x"}, "*"))}},
+    }
+
+    type finding struct{ severity, scope, text string }
+    got := make(map[string][]finding)
+    var order []string
+    for _, report := range assessAccounts(accounts) {
+        order = append(order, report.Severity+" "+report.Account.Name)
+        for _, f := range report.Findings {
+            got[report.Account.Name] = append(got[report.Account.Name], finding{f.Severity, f.Scope, f.Finding})
+        }
+    }
+
+    want := map[string][]finding{
+        "dan": {{"medium", "app", "reads secrets (only: db-password)"}},
+        "bob": {{"critical", "cluster", "bind: may bind roles it doesn't hold, such as cluster-admin (only: cluster-admin)"}},
+        "root": {{"critical", "cluster", "cluster-admin equivalent (all verbs on all resources)"}},
+        "ns-admin": {{"high", "web", "admin of the namespace (all verbs on all resources)"}},
+        "kubelet-reader": {{"critical", "cluster", "nodes/proxy: kubelet API access, runs commands in any pod of a node"}},
+        // a wildcard rule limited to a name is not cluster-admin, but each of its dangerous verbs counts for that name
+        "named-admin": {
+            {"critical", "cluster", "escalate: may create roles with permissions it doesn't have (only: x)"},
+            {"critical", "cluster", "bind: may bind roles it doesn't hold, such as cluster-admin (only: x)"},
+            {"critical", "cluster", "impersonate: may act as other users, groups or ServiceAccounts (only: x)"},
+            {"critical", "cluster", "nodes/proxy: kubelet API access, runs commands in any pod of a node (only: x)"},
+            {"high", "cluster", "wildcard resources (*): also covers resources added later (only: x)"},
+            {"high", "cluster", "reads secrets (only: x)"},
+            {"high", "cluster", "pods/exec or pods/attach: runs commands in running containers (only: x)"},
+            {"high", "cluster", "serviceaccounts/token: issues tokens of ServiceAccounts (only: x)"},
+            {"high", "cluster", "approves certificate signing requests (only: x)"},
+            {"high", "cluster", "writes admission webhook configurations (only: x)"},
+            {"medium", "cluster", "creates pods or workloads, which may run as any ServiceAccount of the namespace (only: x)"},
+            {"medium", "cluster", "wildcard verbs (*): also covers escalate, bind and impersonate where they apply (only: x)"},
+        },
+    }
+    if !reflect.DeepEqual(got, want) {
+        for name := range want {
+            if !reflect.DeepEqual(got[name], want[name]) {
+                t.Errorf("%s: findings = %+v, want %+v", name, got[name], want[name])
+            }
+        }
+        t.Errorf("accounts with findings = %v", order)
+    }
+    wantOrder := []string{"critical bob", "critical root", "critical kubelet-reader", "critical named-admin", "high ns-admin", "medium dan"}
+    if !reflect.DeepEqual(order, wantOrder) {
+        t.Errorf("report order = %v, want %v", order, wantOrder)
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// escalation-paths
+// ---------------------------------------------------------------------------------------
+
+// each path to the target as its actions, with the number of grants of each step
+func escalationActions(t *testing.T, data *rbacData, subject string, target string) []string {
+    t.Helper()
+    start, err := parseSubject(subject)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var result []string
+    for _, path := range newEscalationGraph(data).paths(escalationNode{Subject: start}, target) {
+        var actions []string
+        for _, step := range path {
+            actions = append(actions, fmt.Sprintf("%s [%d]", step.Action, len(step.Grants)))
+        }
+        result = append(result, strings.Join(actions, " / "))
+    }
+    return result
+}
+
+const rbacGroup = "rbac.authorization.k8s.io"
+
+func escalationData() *rbacData {
+    return &rbacData{
+        ClusterRoles: []Role{
+            newRole("ClusterRole", "", "cluster-admin", rule("*", "*", "*")),
+            newRole("ClusterRole", "", "admin", rule("*", "*", "*")),
+            newRole("ClusterRole", "", "impersonate-admin", namedRule("", "users", []string{"admin"}, "impersonate")),
+            newRole("ClusterRole", "", "impersonate-ci", namedRule("", "serviceaccounts", []string{"ci"}, "impersonate")),
+            newRole("ClusterRole", "", "bind-cluster-admin",
+                namedRule(rbacGroup, "clusterroles", []string{"cluster-admin"}, "bind"),
+                rule(rbacGroup, "clusterrolebindings", "create")),
+            newRole("ClusterRole", "", "bind-only", rule(rbacGroup, "clusterroles", "bind")),
+        },
+        Roles: []Role{
+            newRole("Role", "app", "pod-creator", rule("", "pods", "create")),
+            newRole("Role", "app", "self-edit", namedRule(rbacGroup, "roles", []string{"self-edit"}, "escalate", "update")),
+            newRole("Role", "app", "escalate-only", namedRule(rbacGroup, "roles", []string{"escalate-only"}, "escalate")),
+            newRole("Role", "app", "binder", rule(rbacGroup, "rolebindings", "create"), namedRule(rbacGroup, "clusterroles", []string{"admin"}, "bind")),
+        },
+        ClusterRoleBindings: []RoleBinding{
+            newBinding("ClusterRoleBinding", "", "admin", "ClusterRole", "cluster-admin", user("admin")),
+            newBinding("ClusterRoleBinding", "", "ci", "ClusterRole", "impersonate-admin", serviceAccount("app", "ci")),
+            newBinding("ClusterRoleBinding", "", "helper", "ClusterRole", "impersonate-ci", serviceAccount("app", "helper")),
+            newBinding("ClusterRoleBinding", "", "carol", "ClusterRole", "impersonate-admin", user("carol")),
+            newBinding("ClusterRoleBinding", "", "bob", "ClusterRole", "bind-cluster-admin", user("bob")),
+            newBinding("ClusterRoleBinding", "", "frank", "ClusterRole", "bind-only", user("frank")),
+        },
+        RoleBindings: []RoleBinding{
+            newBinding("RoleBinding", "app", "alice", "Role", "pod-creator", user("alice")),
+            newBinding("RoleBinding", "app", "gina", "Role", "self-edit", user("gina")),
+            newBinding("RoleBinding", "app", "ivan", "Role", "escalate-only", user("ivan")),
+            newBinding("RoleBinding", "app", "hank", "Role", "binder", user("hank")),
+            newBinding("RoleBinding", "web", "web", "ClusterRole", "view", user("viewer")),
+        },
+    }
+}
+
+// Every path is a shortest one: alice reaches admin through app/ci in two steps, not through app/helper in three,
+// and the search doesn't go on past the ServiceAccounts that lead nowhere.
+func TestEscalationPathsShortest(t *testing.T) {
+    resetGlobals(t)
+    want := []string{
+        "create a pod that runs as ServiceAccount app/ci [1] / impersonate User admin [1]",
+    }
+    if got := escalationActions(t, escalationData(), "alice", "cluster-admin"); !reflect.DeepEqual(got, want) {
+        t.Errorf("paths = %q, want %q", got, want)
+    }
+}
+
+// rules limited to resourceNames lead only to the named subjects, and RBAC steps need all of their permissions
+func TestEscalationPathsPartnerPermissions(t *testing.T) {
+    resetGlobals(t)
+    tests := []struct {
+        subject string
+        target  string
+        want    []string
+    }{
+        {"carol", "cluster-admin", []string{"impersonate User admin [1]"}},
+        {"bob", "cluster-admin", []string{"create a ClusterRoleBinding to ClusterRole cluster-admin [2]"}},
+        {"frank", "cluster-admin", nil},
+        {"gina", "namespace-admin:app", []string{"add every permission to Role app/self-edit, bound to it by RoleBinding app/gina [1]"}},
+        {"ivan", "namespace-admin:app", nil},
+        {"gina", "cluster-admin", nil},
+        {"hank", "namespace-admin:app", []string{"create a RoleBinding to ClusterRole admin in namespace app [2]"}},
+        {"hank", "namespace-admin:web", nil},
+        {"ServiceAccount:app/helper", "cluster-admin", []string{"impersonate ServiceAccount app/ci [1] / impersonate User admin [1]"}},
+        {"viewer", "cluster-admin", nil},
+    }
+    for _, test := range tests {
+        if got := escalationActions(t, escalationData(), test.subject, test.target); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("%s to %s: paths = %q, want %q", test.subject, test.target, got, test.want)
+        }
+    }
+}
+
+// carol's impersonation is limited to admin, so she has no edge to the other users
+func TestEscalationStepsImpersonateNamed(t *testing.T) {
+    resetGlobals(t)
+    graph := newEscalationGraph(escalationData())
+    var targets []string
+    for _, step := range graph.stepsFrom(escalationNode{Subject: user("carol")}) {
+        targets = append(targets, nodeString(step.To))
+    }
+    if want := []string{"User admin"}; !reflect.DeepEqual(targets, want) {
+        t.Errorf("steps from carol = %v, want %v", targets, want)
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// lint
+// ---------------------------------------------------------------------------------------
+
+func TestLoadLintPolicy(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "policy.yaml")
+    writeFile(t, path, `
+rules:
+- name: no-secrets
+  severity: warning
+  permissions:
+  - resources: [secrets]
+    verbs: [get, list]
+  - apiGroups: [apps]
+    resources: [deployments]
+    verbs: ["*"]
+`)
+    policy, err := loadLintPolicy(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := policy.Rules[0].Permissions[0].APIGroups; !reflect.DeepEqual(got, []string{""}) {
+        t.Errorf("default apiGroups = %q, want the core group", got)
+    }
+    if got := policy.Rules[0].Permissions[1].APIGroups; !reflect.DeepEqual(got, []string{"apps"}) {
+        t.Errorf("apiGroups = %q", got)
+    }
+
+    invalid := map[string]string{
+        "no rules":         "rules: []\n",
+        "no name":          "rules:\n- severity: error\n",
+        "severity":         "rules:\n- name: a\n  severity: fatal\n",
+        "subject kind":     "rules:\n- name: a\n  subjects: {kinds: [Robot]}\n",
+        "except":           "rules:\n- name: a\n  except: [\"ServiceAccount:nonamespace\"]\n",
+        "permission verbs": "rules:\n- name: a\n  permissions: [{resources: [pods]}]\n",
+    }
+    for name, content := range invalid {
+        writeFile(t, path, content)
+        if _, err := loadLintPolicy(path); err == nil {
+            t.Errorf("%s: loadLintPolicy accepted an invalid policy", name)
+        }
+    }
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+    adminBinding := clusterBinding("cluster-admin", rule("*", "*", "*"))
+    defaultBinding := clusterBinding("system:basic-user", rule("authorization.k8s.io", "selfsubjectaccessreviews", "create"))
+    defaultBinding.Default = true
+    viaGroup := adminBinding
+    viaGroup.ViaGroup = "platform-admins"
+    secrets := namespaceBinding("app", "db", namedRule("", "secrets", []string{"db-password"}, "get"))
+
+    accounts := []AccountInfo{
+        {Name: "alice", Type: "User", Bindings: []BindingInfo{adminBinding, defaultBinding}},
+        {Name: "olga", Type: "User", Bindings: []BindingInfo{viaGroup}},
+        {Name: "platform-admins", Type: "Group", Bindings: []BindingInfo{adminBinding}},
+        {Name: "controller", Type: "ServiceAccount", Namespace: "kube-system", Bindings: []BindingInfo{adminBinding}},
+        {Name: "ci", Type: "ServiceAccount", Namespace: "app", Bindings: []BindingInfo{adminBinding, secrets}},
+    }
+    violators := func(rule lintRule) []string {
+        var result []string
+        for _, violation := range evaluatePolicy(&lintPolicy{Rules: []lintRule{rule}}, accounts) {
+            text := accountName(violation.Account) + " " + violation.Binding.RoleRefName
+            if violation.Detail != "" {
+                text += ": " + violation.Detail
+            }
+            result = append(result, text)
+        }
+        return result
+    }
+
+    tests := []struct {
+        name string
+        rule lintRule
+        want []string
+    }{
+        {"no cluster-admin", lintRule{Bindings: lintBindings{Roles: []string{"cluster-admin"}}},
+            []string{"alice cluster-admin", "olga cluster-admin", "platform-admins cluster-admin", "kube-system/controller cluster-admin", "app/ci cluster-admin"}},
+        {"except a group and its members, and ServiceAccounts by pattern",
+            lintRule{Bindings: lintBindings{Roles: []string{"cluster-admin"}}, Except: []string{"Group:platform-admins", "ServiceAccount:kube-system/*"}},
+            []string{"alice cluster-admin", "app/ci cluster-admin"}},
+        {"ServiceAccounts of some namespaces", lintRule{Subjects: lintSubjects{Namespaces: []string{"app"}}, Bindings: lintBindings{Kinds: []string{"RoleBinding"}}},
+            []string{"app/ci db"}},
+        {"default bindings skipped", lintRule{Subjects: lintSubjects{Kinds: []string{"User"}}, Bindings: lintBindings{Roles: []string{"system:*"}}}, nil},
+        {"default bindings included", lintRule{Subjects: lintSubjects{Kinds: []string{"User"}}, Bindings: lintBindings{Roles: []string{"system:*"}}, Defaults: true},
+            []string{"alice system:basic-user"}},
+        {"permissions, also through resourceNames",
+            lintRule{Subjects: lintSubjects{Names: []string{"c*"}}, Permissions: []RoleRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}}},
+            []string{`kube-system/controller cluster-admin: * (all API groups) * (all resources) [* (all verbs)]`, `app/ci cluster-admin: * (all API groups) * (all resources) [* (all verbs)]`, `app/ci db: "" secrets (only: db-password) [get]`}},
+    }
+    for _, test := range tests {
+        if got := violators(test.rule); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("%s: violations = %q, want %q", test.name, got, test.want)
+        }
+    }
+}
+
+
+// ---------------------------------------------------------------------------------------
+// benchmark cis
+// ---------------------------------------------------------------------------------------
+
+func cisResults(controls []cisControl) map[string]string {
+    results := make(map[string]string)
+    for _, control := range controls {
+        results[control.ID] = control.Result
+    }
+    return results
+}
+
+func cisEvidence(controls []cisControl, id string) []string {
+    for _, control := range controls {
+        if control.ID == id {
+            return control.Evidence
+        }
+    }
+    return nil
+}
+
+func TestEvaluateCIS(t *testing.T) {
+    defaults := newBinding("ClusterRoleBinding", "", "system:basic-user", "ClusterRole", "secrets-reader", group("system:authenticated"))
+    defaults.Metadata.Labels = map[string]string{bootstrapLabel: "rbac-defaults"}
+    clean := &rbacData{
+        ClusterRoles: []Role{
+            newRole("ClusterRole", "", "cluster-admin", rule("*", "*", "*")),
+            newRole("ClusterRole", "", "secrets-reader", rule("", "secrets", "get")),
+            newRole("ClusterRole", "", "db-reader", namedRule("", "secrets", []string{"db-password"}, "get")),
+            newRole("ClusterRole", "", "impersonate-admin", namedRule("", "users", []string{"admin"}, "impersonate")),
+        },
+        ClusterRoleBindings: []RoleBinding{defaults},
+    }
+    // cluster-admin has wildcards, but it is part of the default policy
+    clean.ClusterRoles[0].Metadata.Labels = map[string]string{bootstrapLabel: "rbac-defaults"}
+
+    allPass := map[string]string{
+        "5.1.1": "PASS", "5.1.2": "PASS", "5.1.3": "PASS", "5.1.4": "PASS", "5.1.5": "MANUAL", "5.1.6": "MANUAL", "5.1.7": "MANUAL",
+        "5.1.8": "PASS", "5.1.9": "PASS", "5.1.10": "PASS", "5.1.11": "PASS", "5.1.12": "PASS", "5.1.13": "PASS",
+    }
+    with := func(bindings ...RoleBinding) *rbacData {
+        data := *clean
+        data.ClusterRoleBindings = append(append([]RoleBinding(nil), clean.ClusterRoleBindings...), bindings...)
+        return &data
+    }
+    tests := []struct {
+        name     string
+        data     *rbacData
+        flags    InputFlags
+        changed  map[string]string
+        evidence map[string][]string
+    }{
+        {"default policy only", clean, InputFlags{}, nil, nil},
+        {"cluster-admin only under 5.1.1", with(newBinding("ClusterRoleBinding", "", "root", "ClusterRole", "cluster-admin", user("root"))), InputFlags{},
+            map[string]string{"5.1.1": "FAIL"}, map[string][]string{"5.1.1": {"User root: ClusterRoleBinding root"}, "5.1.2": nil}},
+        {"secrets limited to names", with(newBinding("ClusterRoleBinding", "", "dan", "ClusterRole", "db-reader", user("dan"))), InputFlags{},
+            map[string]string{"5.1.2": "WARN"}, map[string][]string{"5.1.2": {`User dan: ClusterRoleBinding dan -> ClusterRole db-reader: "" secrets (only: db-password) [get]`}}},
+        {"secrets with and without names", with(
+            newBinding("ClusterRoleBinding", "", "dan", "ClusterRole", "db-reader", user("dan")),
+            newBinding("ClusterRoleBinding", "", "eve", "ClusterRole", "secrets-reader", user("eve"))), InputFlags{},
+            map[string]string{"5.1.2": "FAIL"}, nil},
+        {"impersonation limited to names", with(newBinding("ClusterRoleBinding", "", "carol", "ClusterRole", "impersonate-admin", user("carol"))), InputFlags{},
+            map[string]string{"5.1.8": "FAIL"}, map[string][]string{"5.1.8": {`User carol: ClusterRoleBinding carol -> ClusterRole impersonate-admin: "" users (only: admin) [impersonate(!)]`}}},
+        {"default ServiceAccount", with(newBinding("ClusterRoleBinding", "", "default", "ClusterRole", "db-reader", serviceAccount("app", "default"))), InputFlags{},
+            map[string]string{"5.1.2": "WARN", "5.1.5": "FAIL"}, nil},
+        {"system bindings with --nosys", with(newBinding("ClusterRoleBinding", "", "system:reader", "ClusterRole", "secrets-reader", user("eve"))), InputFlags{ExcludeSystem: true},
+            nil, nil},
+    }
+    for _, test := range tests {
+        controls := evaluateCIS(test.data, test.flags, []string{"system:"})
+        want := make(map[string]string)
+        for id, result := range allPass {
+            want[id] = result
+        }
+        for id, result := range test.changed {
+            want[id] = result
+        }
+        if got := cisResults(controls); !reflect.DeepEqual(got, want) {
+            t.Errorf("%s: results = %v, want %v", test.name, got, want)
+        }
+        for id, evidence := range test.evidence {
+            if got := cisEvidence(controls, id); !reflect.DeepEqual(got, evidence) {
+                t.Errorf("%s: %s evidence = %q, want %q", test.name, id, got, evidence)
+            }
+        }
+    }
+}
+
+// wildcards of roles count for 5.1.3 whether or not the roles are bound, URL wildcards included
+func TestEvaluateCISWildcards(t *testing.T) {
+    data := &rbacData{ClusterRoles: []Role{
+        newRole("ClusterRole", "", "all-verbs", rule("", "pods", "*")),
+        newRole("ClusterRole", "", "urls", RoleRule{NonResourceURLs: []string{"/api/*"}, Verbs: []string{"get"}}),
+        newRole("ClusterRole", "", "fine", rule("", "pods", "get")),
+    }}
+    controls := evaluateCIS(data, InputFlags{}, nil)
+    want := []string{`ClusterRole all-verbs: "" pods [* (all verbs)]`, `ClusterRole urls: (non-resource) /api/* (!wildcard) [get]`}
+    if got := cisEvidence(controls, "5.1.3"); !reflect.DeepEqual(got, want) {
+        t.Errorf("5.1.3 evidence = %q, want %q", got, want)
+    }
+}